@@ -0,0 +1,58 @@
+/*
+Copyright © 2024 Andy Holt <andrew.holt@hotmail.co.uk>
+*/
+package cmd
+
+import (
+	"github.com/AndyHolt/cic/imgproc"
+
+	"github.com/spf13/cobra"
+)
+
+var BookTitle string
+var BookPageNumbers bool
+var BookTitles bool
+var BookIndex bool
+
+// bookCmd represents the book command
+var bookCmd = &cobra.Command{
+	Use:   "book [flags] filename...",
+	Short: "Make a colouring book from many image files",
+	Long: `Make a colouring book from many image files.
+
+Each image is turned into a colouring sheet, as by cic itself, and the sheets
+are written in order to a single PDF, one to a page. The pipeline and page
+layout are tuned by the same flags as for a single sheet.
+
+A cover page with --title, page numbers, a title above each sheet from its file
+name, and contact sheets indexing the book with a thumbnail of every sheet can
+be added. Output is written to book.pdf unless --output is given.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output := OutputFileName
+		if !cmd.Flags().Changed("output") {
+			output = "book.pdf"
+		}
+
+		cic.MakeBook(args, output, colouringOptions(cmd), cic.BookOptions{
+			Title:       BookTitle,
+			PageNumbers: BookPageNumbers,
+			Titles:      BookTitles,
+			Index:       BookIndex,
+		})
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(bookCmd)
+
+	bookCmd.Flags().StringVar(&BookTitle, "title", "",
+		"Title for a cover page (no cover if empty)")
+	bookCmd.Flags().BoolVar(&BookPageNumbers, "page-numbers", true,
+		"Number the pages after the cover")
+	bookCmd.Flags().BoolVar(&BookTitles, "titles", false,
+		"Set a title above each sheet, from its file name")
+	bookCmd.Flags().BoolVar(&BookIndex, "index", false,
+		"Add contact sheets after the cover, indexing every sheet")
+	addColouringFlags(bookCmd)
+}
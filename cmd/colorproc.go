@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var ColourSpaceName string
+
 // colorprocCmd represents the colorproc command
 var colorprocCmd = &cobra.Command{
 	Use:   "colorproc",
@@ -18,10 +20,20 @@ var colorprocCmd = &cobra.Command{
 Standard usage of cic converts picture to grayscale, making use only of colour
 intensity for further processing. This is an experimental feature to use colour
 information for better edge detection between regions of similar colour
-intensity, but different colour profile.`,
+intensity, but different colour profile.
+
+Gradients are measured in the colour space selected by --colourspace. The lab
+space follows perceived colour difference most closely.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cic.RunColourImageProc(args[0], OutputFileName)
+		cs, err := cic.ParseColourSpace(ColourSpaceName)
+		cobra.CheckErr(err)
+		_, err = cic.OutputFormat("", OutputFileName, cic.ImageFormats)
+		cobra.CheckErr(err)
+		background, err := cic.ParseHexColour(Background)
+		cobra.CheckErr(err)
+
+		cic.RunColourImageProc(args[0], OutputFileName, cs, background)
 	},
 }
 
@@ -37,4 +49,7 @@ func init() {
 	// Cobra supports local flags which will only run when this command
 	// is called directly, e.g.:
 	// colorprocCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+	colorprocCmd.Flags().StringVar(&ColourSpaceName, "colourspace", "rgb",
+		"Colour space for measuring gradients: rgb, lab or hsv")
+	addBackgroundFlag(colorprocCmd)
 }
@@ -4,12 +4,27 @@ Copyright © 2024 Andy Holt <andrew.holt@hotmail.co.uk>
 package cmd
 
 import (
+	"fmt"
+
 	"github.com/AndyHolt/cic/imgproc"
 
 	"github.com/spf13/cobra"
 )
 
 var Clusters int
+var AutoClusters bool
+var MinClusters int
+var MaxClusters int
+var AutoMethod string
+var QuantiseMethod string
+var SpatialWeight float64
+var MinRegionSize int
+var PaletteFile string
+var SavePaletteFiles []string
+var MaxIterations int
+var Tolerance float64
+var Restarts int
+var Seed int64
 
 // kmeansCmd represents the kmeans command
 var kmeansCmd = &cobra.Command{
@@ -19,13 +34,97 @@ var kmeansCmd = &cobra.Command{
 
 This reduces information in the image by a means of compression and
 dimensionality reduction, and may lead to distinct areas of the image being
-better identified by edge detection algorithms.`,
+better identified by edge detection algorithms.
+
+Means are seeded using k-means++, and each run stops once the cost stops
+improving by more than the tolerance. Several runs are made and the one with
+the lowest cost is kept. Pass --seed to reproduce an earlier result.
+
+Colour distances are measured in the colour space selected by --colourspace.
+The lab space groups colours by perceived difference rather than raw RGB
+values.
+
+With --auto, the number of clusters is chosen by clustering with each k from
+--min-clusters to --max-clusters, and picking either the elbow of the cost
+curve or the k with the highest silhouette score (see --auto-method).
+
+Other colour quantisers can be chosen with --method. The mediancut, octree and
+wu methods are deterministic and fast, and ignore the k-means specific flags.
+--auto is only available with kmeans.
+
+A --spatial-weight above zero adds pixel positions to the k-means features, so
+that distant objects of the same colour can be separated. With any method,
+--min-region merges speckles smaller than the given number of pixels into
+their neighbours.
+
+The colours found can be saved with --save-palette, as JSON (.json), a GIMP
+palette (.gpl) or a swatch image (.png); the flag may be repeated. To map
+pixels to a fixed set of colours, such as the crayons to hand, instead of
+learning colours from the image, pass a .json or .gpl file to --palette; the
+flags choosing and tuning the quantiser can't then be given.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cic.RunKMeansImage(args[0], OutputFileName, Clusters)
+		cs, err := cic.ParseColourSpace(ColourSpaceName)
+		cobra.CheckErr(err)
+		_, err = cic.OutputFormat("", OutputFileName, cic.ImageFormats)
+		cobra.CheckErr(err)
+		background, err := cic.ParseHexColour(Background)
+		cobra.CheckErr(err)
+
+		if PaletteFile != "" {
+			cobra.CheckErr(checkPaletteFlags(cmd, "clusters", "method", "auto", "min-clusters",
+				"max-clusters", "auto-method", "max-iterations", "tolerance", "restarts",
+				"spatial-weight", "seed"))
+		} else if Clusters < 1 && !AutoClusters {
+			cobra.CheckErr(fmt.Errorf("--clusters must be at least 1, got %v (use --auto to choose it)", Clusters))
+		}
+
+		opts := cic.DefaultKMeansOptions(Clusters)
+		opts.Space = cs
+		if AutoClusters {
+			if QuantiseMethod != "kmeans" {
+				cobra.CheckErr(fmt.Errorf("--auto can only be used with the kmeans method, not %v", QuantiseMethod))
+			}
+			opts.K = 0
+		}
+		if AutoMethod != "elbow" && AutoMethod != "silhouette" {
+			cobra.CheckErr(fmt.Errorf("unknown auto method %q (valid options are elbow and silhouette)", AutoMethod))
+		}
+		opts.MinK = MinClusters
+		opts.MaxK = MaxClusters
+		opts.KMethod = AutoMethod
+		opts.SpatialWeight = SpatialWeight
+		opts.MaxIterations = MaxIterations
+		opts.Tolerance = Tolerance
+		opts.Restarts = Restarts
+		opts.Seed = Seed
+
+		var q cic.Quantiser
+		if PaletteFile != "" {
+			palette, err := cic.LoadPalette(PaletteFile)
+			cobra.CheckErr(err)
+			q = cic.FixedPalette{Palette: palette, Space: cs}
+		} else {
+			q, err = cic.NewQuantiser(QuantiseMethod, opts)
+			cobra.CheckErr(err)
+		}
+
+		cic.RunQuantiseImage(args[0], OutputFileName, q, MinRegionSize, SavePaletteFiles, background)
 	},
 }
 
+// checkPaletteFlags returns an error if any of the named flags, which only
+// tune the quantiser, were given to cmd along with a --palette which replaces
+// it.
+func checkPaletteFlags(cmd *cobra.Command, names ...string) error {
+	for _, name := range names {
+		if cmd.Flags().Changed(name) {
+			return fmt.Errorf("--%v can't be used with --palette, which gives the colours", name)
+		}
+	}
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(kmeansCmd)
 
@@ -40,4 +139,33 @@ func init() {
 	// kmeansCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	kmeansCmd.Flags().IntVarP(&Clusters, "clusters", "k", 4,
 		"Number of clusters for k-means")
+	kmeansCmd.Flags().StringVarP(&QuantiseMethod, "method", "m", "kmeans",
+		"Colour quantisation method: kmeans, mediancut, octree or wu")
+	kmeansCmd.Flags().BoolVarP(&AutoClusters, "auto", "a", false,
+		"Choose the number of clusters automatically")
+	kmeansCmd.Flags().IntVar(&MinClusters, "min-clusters", 2,
+		"Smallest number of clusters tried with --auto")
+	kmeansCmd.Flags().IntVar(&MaxClusters, "max-clusters", 10,
+		"Largest number of clusters tried with --auto")
+	kmeansCmd.Flags().StringVar(&AutoMethod, "auto-method", "silhouette",
+		"Method for choosing clusters with --auto: elbow or silhouette")
+	kmeansCmd.Flags().IntVar(&MaxIterations, "max-iterations", 50,
+		"Maximum number of iterations in each k-means run")
+	kmeansCmd.Flags().Float64Var(&Tolerance, "tolerance", 1e-4,
+		"Relative cost improvement below which k-means has converged")
+	kmeansCmd.Flags().IntVarP(&Restarts, "restarts", "r", 3,
+		"Number of k-means runs, keeping the lowest cost result")
+	kmeansCmd.Flags().StringVar(&ColourSpaceName, "colourspace", "rgb",
+		"Colour space for measuring colour distance: rgb, lab or hsv")
+	kmeansCmd.Flags().Float64Var(&SpatialWeight, "spatial-weight", 0,
+		"Weight of pixel position in k-means features (0 clusters on colour only)")
+	kmeansCmd.Flags().IntVar(&MinRegionSize, "min-region", 0,
+		"Merge regions smaller than this many pixels into their neighbours")
+	kmeansCmd.Flags().StringVarP(&PaletteFile, "palette", "p", "",
+		"Map pixels to the colours of this .json or .gpl palette file")
+	kmeansCmd.Flags().StringSliceVar(&SavePaletteFiles, "save-palette", nil,
+		"Save the palette to this .json, .gpl or .png file (may be repeated)")
+	kmeansCmd.Flags().Int64Var(&Seed, "seed", 0,
+		"Random seed for reproducible output (0 picks a seed from the clock)")
+	addBackgroundFlag(kmeansCmd)
 }
@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Andy Holt <andrew.holt@hotmail.co.uk>
+*/
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/AndyHolt/cic/imgproc"
+
+	"github.com/spf13/cobra"
+)
+
+var PbnClusters int
+var PbnMethod string
+var PbnPaletteFile string
+var PbnColourSpaceName string
+var PbnStdDev float64
+var PbnMinRegionSize int
+var PbnMinLabelSize int
+var PbnMaxLabelSize int
+var PbnSeed int64
+
+// paintByNumberCmd represents the paint-by-number command
+var paintByNumberCmd = &cobra.Command{
+	Use:   "paint-by-number",
+	Short: "Make a paint-by-number sheet from an image file",
+	Long: `Make a paint-by-number sheet from an image file.
+
+The image is blurred and its colours quantised, as by the kmeans command. The
+outlines of the resulting regions are drawn in black on white, and each region
+is numbered with its colour, at the point farthest from its edges and in the
+largest font that fits. A legend of numbered colour swatches is drawn below.
+
+Regions smaller than --min-region pixels, or too narrow to hold a number at
+--min-label size, are merged into their neighbours, so every region on the
+sheet can be numbered.
+
+To paint with a fixed set of colours, pass a .json or .gpl palette file to
+--palette; the legend then shows the colours' names.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cs, err := cic.ParseColourSpace(PbnColourSpaceName)
+		cobra.CheckErr(err)
+		_, err = cic.OutputFormat("", OutputFileName, cic.ImageFormats)
+		cobra.CheckErr(err)
+		background, err := cic.ParseHexColour(Background)
+		cobra.CheckErr(err)
+
+		if PbnPaletteFile != "" {
+			cobra.CheckErr(checkPaletteFlags(cmd, "clusters", "method", "seed"))
+		} else if PbnClusters < 1 {
+			cobra.CheckErr(fmt.Errorf("--clusters must be at least 1, got %v", PbnClusters))
+		}
+
+		opts := cic.DefaultKMeansOptions(PbnClusters)
+		opts.Space = cs
+		opts.Seed = PbnSeed
+
+		var q cic.Quantiser
+		if PbnPaletteFile != "" {
+			palette, err := cic.LoadPalette(PbnPaletteFile)
+			cobra.CheckErr(err)
+			q = cic.FixedPalette{Palette: palette, Space: cs}
+		} else {
+			q, err = cic.NewQuantiser(PbnMethod, opts)
+			cobra.CheckErr(err)
+		}
+
+		pbnOpts := cic.DefaultPaintByNumberOptions()
+		pbnOpts.MinRegionSize = PbnMinRegionSize
+		pbnOpts.MinLabelSize = PbnMinLabelSize
+		pbnOpts.MaxLabelSize = max(PbnMaxLabelSize, PbnMinLabelSize)
+		pbnOpts.Background = background
+
+		cic.RunPaintByNumber(args[0], OutputFileName, q, PbnStdDev, pbnOpts)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(paintByNumberCmd)
+
+	paintByNumberCmd.Flags().IntVarP(&PbnClusters, "clusters", "k", 12,
+		"Number of colours to paint with")
+	paintByNumberCmd.Flags().StringVarP(&PbnMethod, "method", "m", "kmeans",
+		"Colour quantisation method: kmeans, mediancut, octree or wu")
+	paintByNumberCmd.Flags().StringVarP(&PbnPaletteFile, "palette", "p", "",
+		"Paint with the colours of this .json or .gpl palette file")
+	paintByNumberCmd.Flags().StringVar(&PbnColourSpaceName, "colourspace", "lab",
+		"Colour space for measuring colour distance: rgb, lab or hsv")
+	paintByNumberCmd.Flags().Float64VarP(&PbnStdDev, "stddev", "s", 2.0,
+		"Standard deviation of Gaussian blur applied before quantising")
+	paintByNumberCmd.Flags().IntVar(&PbnMinRegionSize, "min-region", 64,
+		"Merge regions smaller than this many pixels into their neighbours")
+	paintByNumberCmd.Flags().IntVar(&PbnMinLabelSize, "min-label", 8,
+		"Smallest font size for region numbers, in pixels")
+	paintByNumberCmd.Flags().IntVar(&PbnMaxLabelSize, "max-label", 32,
+		"Largest font size for region numbers, in pixels")
+	paintByNumberCmd.Flags().Int64Var(&PbnSeed, "seed", 0,
+		"Random seed for reproducible output (0 picks a seed from the clock)")
+	addBackgroundFlag(paintByNumberCmd)
+}
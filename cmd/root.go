@@ -4,6 +4,7 @@ Copyright © 2023 Andy Holt <andrew.holt@hotmail.co.uk>
 package cmd
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/AndyHolt/cic/imgproc"
@@ -17,30 +18,82 @@ var LowerThreshold int
 var NonMaxSuppressionDistance int
 var ThickerThreshold int
 var ThinnerThreshold int
+var MaxGap int
+var MaxAngle float64
+var ReportRegions bool
+var Thin bool
+var Morphology []string
+var Prune int
+var MinLineLength int
+var MinWidth float64
+var MaxWidth float64
+var Format string
+var Smooth bool
+var Simplify string
+var SimplifyTolerance float64
+var CornerAngle float64
+var SVGBackground bool
+var Paper string
+var Orientation string
+var Margin float64
+var DPI float64
+var ScaleToFit bool
+var PDFVector bool
+var Background string
+var AlphaOutline bool
+var Transparent bool
+var MaxSize int
+var ResizeWidth int
+var ResizeHeight int
+var ResizeFilter string
+var Crop string
+var Trim bool
+var Scales []float64
+var MinScales int
+var Frames string
+var FrameInterval int
+var SceneThreshold float64
+var MaxFrames int
 
 // upper (u) and lower (l) for setting threshold values
 // no-blur option
 
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
-	Use:   "cic [flags] filename",
+	Use:   "cic [flags] filename|directory",
 	Short: "CIC is a Colouring-In Creator (or Colouring Image Creator)",
 	Long: `CIC, the Colouring-In Creator, turns images into colouring sheets.
 
 CIC uses image processing and edge detection techniques to turn any image file
-into a colouring sheet.`,
+into a colouring sheet. Given an animated GIF or a directory of frames, it makes
+a sheet of each chosen frame.`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		cic.ConvertImageToColouring(
-			args[0],
-			OutputFileName,
-			StdDev,
-			UpperThreshold,
-			LowerThreshold,
-			NonMaxSuppressionDistance,
-			ThickerThreshold,
-			ThinnerThreshold,
-		)
+		format, err := cic.OutputFormat(Format, OutputFileName, cic.ColouringFormats)
+		cobra.CheckErr(err)
+
+		opts := colouringOptions(cmd)
+		opts.Format = format
+		opts.SVGBackground = SVGBackground
+		opts.Transparent = Transparent
+
+		frames, err := cic.OpenAnimation(args[0])
+		cobra.CheckErr(err)
+		if frames == nil {
+			cic.ConvertImageToColouring(args[0], OutputFileName, opts)
+			return
+		}
+
+		sel := cic.FrameSelection{
+			Interval:       FrameInterval,
+			SceneThreshold: SceneThreshold,
+			MaxFrames:      MaxFrames,
+		}
+		if Frames != "" {
+			sel.Indices, err = cic.ParseFrameIndices(Frames)
+			cobra.CheckErr(err)
+		}
+		cic.ConvertFramesToColouring(frames, OutputFileName, opts, sel)
 	},
 }
 
@@ -60,20 +113,181 @@ func init() {
 
 	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.cic.yaml)")
 	rootCmd.PersistentFlags().StringVarP(&OutputFileName, "output", "o",
-		"edited.jpg", "File name of output")
+		"edited.png", "File name of output, whose extension chooses its format")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
-	rootCmd.Flags().Float64VarP(&StdDev, "stddev", "s", 1.0,
+	rootCmd.Flags().StringVar(&Format, "format", "",
+		"Output format: png, jpeg, gif, bmp, tiff, svg for vector lines, or pdf for printing (default from the output file's extension)")
+	rootCmd.Flags().BoolVar(&SVGBackground, "svg-background", true,
+		"Fill SVG output with white behind the lines")
+	rootCmd.Flags().BoolVar(&Transparent, "transparent", false,
+		"Write the lines on a transparent background (png, gif, tiff or svg)")
+	rootCmd.Flags().StringVar(&Frames, "frames", "",
+		"Frames of an animation to make sheets of, from 0, such as 0,5,10-12 (default the sharpest of each scene)")
+	rootCmd.Flags().IntVar(&FrameInterval, "every", 0,
+		"Make a sheet of every nth frame of an animation")
+	rootCmd.Flags().Float64Var(&SceneThreshold, "scene-threshold", 0.1,
+		"Change in brightness, from 0 to 1, between frames which starts a new scene")
+	rootCmd.Flags().IntVar(&MaxFrames, "max-frames", 0,
+		"Largest number of scenes to make sheets of, keeping the biggest changes (0 for no limit)")
+	addColouringFlags(rootCmd)
+}
+
+// addColouringFlags adds the flags setting the colouring pipeline's options
+// to cmd.
+func addColouringFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(&MaxSize, "max-size", 0,
+		"Shrink the image so neither side is longer than this many pixels before finding edges (0 for no limit)")
+	cmd.Flags().IntVar(&ResizeWidth, "width", 0,
+		"Resize the image to this width in pixels before finding edges")
+	cmd.Flags().IntVar(&ResizeHeight, "height", 0,
+		"Resize the image to this height in pixels before finding edges")
+	cmd.Flags().StringVar(&ResizeFilter, "filter", "lanczos",
+		"Resampling filter for resizing: lanczos, bicubic or box")
+	cmd.Flags().StringVar(&Crop, "crop", "",
+		"Crop the image to x,y,w,h in pixels before resizing")
+	cmd.Flags().BoolVar(&Trim, "trim", false,
+		"Trim borders of a uniform colour from the image")
+	cmd.Flags().Float64VarP(&StdDev, "stddev", "s", 1.0,
 		"Std dev for Gaussian blur")
-	rootCmd.Flags().IntVarP(&UpperThreshold, "upper", "u", 100,
+	cmd.Flags().Float64SliceVar(&Scales, "scales", nil,
+		"Std devs of blur to find edges at, such as 1,2,4, keeping edges which persist over several (replaces --stddev)")
+	cmd.Flags().IntVar(&MinScales, "min-scales", 2,
+		"Number of --scales an edge must persist over to be kept")
+	cmd.Flags().IntVarP(&UpperThreshold, "upper", "u", 100,
 		"Upper threshold for edge suppression")
-	rootCmd.Flags().IntVarP(&LowerThreshold, "lower", "l", 10,
+	cmd.Flags().IntVarP(&LowerThreshold, "lower", "l", 10,
 		"Lower threshold for edge suppression")
-	rootCmd.Flags().IntVarP(&NonMaxSuppressionDistance, "distance", "d", 1,
+	cmd.Flags().IntVarP(&NonMaxSuppressionDistance, "distance", "d", 1,
 		"Interval for non-maximum suppression in pixels")
-	rootCmd.Flags().IntVarP(&ThickerThreshold, "thicker", "t", 50,
-		"Gray value threshold for thicker lines")
-	rootCmd.Flags().IntVarP(&ThinnerThreshold, "thinner", "i", 150,
-		"Gray value threshold for thinner lines")
+	cmd.Flags().IntVarP(&ThickerThreshold, "thicker", "t", 50,
+		"Gray value threshold for thicker lines (with --max-width 0)")
+	cmd.Flags().IntVarP(&ThinnerThreshold, "thinner", "i", 150,
+		"Gray value threshold for thinner lines (with --max-width 0)")
+	cmd.Flags().Float64Var(&MinWidth, "min-width", 1,
+		"Width in pixels of lines for the weakest edges")
+	cmd.Flags().Float64Var(&MaxWidth, "max-width", 4,
+		"Width in pixels of lines for the strongest edges (0 thickens by --thicker and --thinner instead)")
+	cmd.Flags().BoolVar(&Smooth, "smooth", false,
+		"Fit vector lines with Bézier curves rather than straight segments")
+	cmd.Flags().StringVar(&Simplify, "simplify", "rdp",
+		"Simplification of vector lines: rdp (Ramer-Douglas-Peucker), visvalingam or none")
+	cmd.Flags().Float64Var(&SimplifyTolerance, "tolerance", 1,
+		"Distance in pixels vector lines may stray from the traced edges when simplified and smoothed")
+	cmd.Flags().Float64Var(&CornerAngle, "corner-angle", 60,
+		"Turn in degrees at which smoothed vector lines keep a sharp corner")
+	cmd.Flags().StringVar(&Paper, "paper", "a4",
+		"Paper size of PDF output: a4, a5 or letter")
+	cmd.Flags().StringVar(&Orientation, "orientation", "auto",
+		"Page orientation of PDF output: auto, portrait or landscape")
+	cmd.Flags().Float64Var(&Margin, "margin", 10,
+		"Margin around the sheet in PDF output, in millimetres")
+	cmd.Flags().Float64Var(&DPI, "dpi", 300,
+		"Resolution at which PDF output prints the sheet, with --fit=false")
+	cmd.Flags().BoolVar(&ScaleToFit, "fit", true,
+		"Scale the sheet to fill the page in PDF output")
+	cmd.Flags().BoolVar(&PDFVector, "pdf-vector", false,
+		"Embed traced vector lines in PDF output rather than the raster sheet")
+	cmd.Flags().BoolVar(&Thin, "thin", true,
+		"Thin edges to one pixel wide before thickening lines")
+	cmd.Flags().IntVar(&Prune, "prune", 0,
+		"Prune spurs of up to this many pixels from lines")
+	cmd.Flags().IntVar(&MinLineLength, "min-line-length", 0,
+		"Remove lines of fewer than this many pixels")
+	cmd.Flags().StringSliceVar(&Morphology, "morphology", nil,
+		"Morphological operation on edges, as op[:shape[:radius]], e.g. close:disk:2 (may be repeated)")
+	cmd.Flags().IntVar(&MaxGap, "max-gap", 0,
+		"Bridge gaps of up to this many pixels at the ends of lines (0 leaves gaps open)")
+	cmd.Flags().Float64Var(&MaxAngle, "max-angle", 30,
+		"Largest angle in degrees between a line and a bridge continuing it")
+	cmd.Flags().BoolVar(&ReportRegions, "regions", false,
+		"Report the number and sizes of closed regions in the output")
+	addBackgroundFlag(cmd)
+	cmd.Flags().BoolVar(&AlphaOutline, "alpha-outline", false,
+		"Outline the opaque parts of a transparent image")
+}
+
+// addBackgroundFlag adds the --background flag, for the colour transparent
+// images are composited onto, to cmd.
+func addBackgroundFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&Background, "background", "#ffffff",
+		"Colour, as hex, that transparent parts of the image are composited onto")
+}
+
+// colouringOptions returns the colouring pipeline's options set by the flags
+// added by addColouringFlags to cmd.
+func colouringOptions(cmd *cobra.Command) cic.ColouringOptions {
+	var morphology []cic.MorphologyOp
+	for _, s := range Morphology {
+		op, err := cic.ParseMorphologyOp(s)
+		cobra.CheckErr(err)
+		morphology = append(morphology, op)
+	}
+	if MaxGap > 0 && !Thin {
+		cobra.CheckErr(fmt.Errorf("--max-gap needs --thin, as gaps are bridged from the ends of thinned lines"))
+	}
+
+	pdfOpts := cic.PDFOptions{
+		Paper:       Paper,
+		Orientation: Orientation,
+		Margin:      Margin,
+		DPI:         DPI,
+		ScaleToFit:  ScaleToFit,
+		Vector:      PDFVector,
+	}
+	cobra.CheckErr(pdfOpts.Validate())
+	cobra.CheckErr(cic.ValidateSimplify(Simplify))
+	background, err := cic.ParseHexColour(Background)
+	cobra.CheckErr(err)
+
+	resizeOpts := cic.ResizeOptions{
+		Trim:    Trim,
+		Width:   ResizeWidth,
+		Height:  ResizeHeight,
+		MaxSize: MaxSize,
+		Filter:  ResizeFilter,
+	}
+	if Crop != "" {
+		resizeOpts.Crop, err = cic.ParseCrop(Crop)
+		cobra.CheckErr(err)
+	}
+	cobra.CheckErr(resizeOpts.Validate())
+	cobra.CheckErr(cic.ValidateScales(Scales, MinScales))
+	if len(Scales) > 0 && cmd.Flags().Changed("stddev") {
+		cobra.CheckErr(fmt.Errorf("--scales replaces --stddev, so only one of them can be given"))
+	}
+	sigma := StdDev
+	if len(Scales) == 1 {
+		sigma = Scales[0]
+	}
+
+	return cic.ColouringOptions{
+		Sigma:                     sigma,
+		UpperThreshold:            UpperThreshold,
+		LowerThreshold:            LowerThreshold,
+		NonMaxSuppressionDistance: NonMaxSuppressionDistance,
+		ThickerThreshold:          ThickerThreshold,
+		ThinnerThreshold:          ThinnerThreshold,
+		Thin:                      Thin,
+		Prune:                     Prune,
+		MinLineLength:             MinLineLength,
+		Gaps:                      cic.GapOptions{MaxGap: MaxGap, MaxAngle: MaxAngle},
+		Morphology:                morphology,
+		MinWidth:                  MinWidth,
+		MaxWidth:                  MaxWidth,
+		PDF:                       pdfOpts,
+		ReportRegions:             ReportRegions,
+		Background:                background,
+		AlphaOutline:              AlphaOutline,
+		Resize:                    resizeOpts,
+		Scales:                    Scales,
+		MinScales:                 MinScales,
+		Vector: cic.PathOptions{
+			Simplify:    Simplify,
+			Tolerance:   SimplifyTolerance,
+			Smooth:      Smooth,
+			CornerAngle: CornerAngle,
+		},
+	}
 }
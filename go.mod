@@ -4,10 +4,12 @@ go 1.21.1
 
 require (
 	github.com/spf13/cobra v1.8.0
+	golang.org/x/image v0.18.0
 	k8s.io/apimachinery v0.29.0
 )
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
+	golang.org/x/text v0.16.0 // indirect
 )
@@ -0,0 +1,81 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+)
+
+// TransparentFormats lists the output formats which can have a transparent
+// background.
+var TransparentFormats = []string{"png", "gif", "tiff", "svg"}
+
+// HasAlpha reports whether any pixel of img is less than fully opaque.
+func HasAlpha(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return !o.Opaque()
+	}
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CompositeImage draws img over a background of colour bg, so that its
+// transparent parts show the background rather than whatever colour their
+// pixels happen to hold.
+func CompositeImage(img image.Image, bg color.Color) *image.RGBA {
+	bounds := img.Bounds()
+	out := image.NewRGBA(bounds)
+	draw.Draw(out, bounds, image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(out, bounds, img, bounds.Min, draw.Over)
+	return out
+}
+
+// AddAlphaOutline adds the outline of the opaque parts of img, which the
+// gradients were found from, as edges of full strength. A pixel is opaque
+// if it is at least half so, and on the outline if it is opaque with a
+// transparent 4-neighbour.
+func (ig *ImageGradients) AddAlphaOutline(img image.Image) *ImageGradients {
+	bounds := img.Bounds()
+	opaque := func(i, j int) bool {
+		_, _, _, a := img.At(bounds.Min.X+i, bounds.Min.Y+j).RGBA()
+		return a >= 0x8000
+	}
+
+	for j := 0; j < ig.Y; j++ {
+		for i := 0; i < ig.X; i++ {
+			if !opaque(i, j) {
+				continue
+			}
+			for _, off := range neighbourOffsets[:4] {
+				ni, nj := i+off.X, j+off.Y
+				inside := ni >= 0 && ni < ig.X && nj >= 0 && nj < ig.Y
+				if inside && !opaque(ni, nj) {
+					ig.Value[j][i] = 255
+					break
+				}
+			}
+		}
+	}
+	return ig
+}
+
+// TransparentLineArt converts black lines on white to black lines on a
+// transparent background, with each pixel's opacity its darkness, so that
+// anti-aliased edges stay smooth over any background.
+func TransparentLineArt(img *image.Gray) *image.NRGBA {
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			out.SetNRGBA(x, y, color.NRGBA{0, 0, 0, 255 - img.GrayAt(x, y).Y})
+		}
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// alphaSquare returns a 20 × 20 image, transparent but for an opaque dark
+// square from 5 to 14. Its transparent pixels hold black, as clip-art's
+// often do.
+func alphaSquare() *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, 20, 20))
+	for y := 5; y < 15; y++ {
+		for x := 5; x < 15; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{30, 30, 30, 255})
+		}
+	}
+	return img
+}
+
+func TestCompositeImage(t *testing.T) {
+	img := alphaSquare()
+	if !HasAlpha(img) {
+		t.Fatalf("Image with transparent pixels has no alpha\n")
+	}
+
+	out := CompositeImage(img, color.RGBA{255, 0, 0, 255})
+	if HasAlpha(out) {
+		t.Fatalf("Composited image has alpha\n")
+	}
+	if c := out.RGBAAt(0, 0); c != (color.RGBA{255, 0, 0, 255}) {
+		t.Fatalf("Transparent pixel composited to %v, expected the background\n", c)
+	}
+	if c := out.RGBAAt(10, 10); c != (color.RGBA{30, 30, 30, 255}) {
+		t.Fatalf("Opaque pixel composited to %v, expected it unchanged\n", c)
+	}
+
+	// Grayscale conversion composites onto white, so that the square has an
+	// edge to find
+	if g := GrayscaleImage(img).GrayAt(0, 0).Y; g != 255 {
+		t.Fatalf("Transparent pixel converted to gray level %d, expected 255\n", g)
+	}
+}
+
+func TestImageToRGBA(t *testing.T) {
+	img := alphaSquare()
+
+	cases := []struct {
+		bg       color.Color
+		expected color.RGBA
+	}{
+		{nil, color.RGBA{255, 255, 255, 255}},
+		{color.RGBA{0, 0, 255, 255}, color.RGBA{0, 0, 255, 255}},
+	}
+	for _, c := range cases {
+		out := imageToRGBA(img, c.bg)
+		if got := out.RGBAAt(0, 0); got != c.expected {
+			t.Errorf("Transparent pixel on background %v converted to %v, expected %v\n",
+				c.bg, got, c.expected)
+		}
+		if got := out.RGBAAt(10, 10); got != (color.RGBA{30, 30, 30, 255}) {
+			t.Errorf("Opaque pixel on background %v converted to %v, expected it unchanged\n",
+				c.bg, got)
+		}
+	}
+}
+
+func TestAddAlphaOutline(t *testing.T) {
+	img := alphaSquare()
+	ig := CreateImageGradients(20, 20).AddAlphaOutline(img)
+
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			onOutline := (x == 5 || x == 14) && y >= 5 && y < 15 || (y == 5 || y == 14) && x >= 5 && x < 15
+			if (ig.Value[y][x] == 255) != onOutline {
+				t.Fatalf("Pixel (%d, %d) has edge value %d, on outline: %v\n", x, y, ig.Value[y][x], onOutline)
+			}
+		}
+	}
+}
+
+func TestTransparentLineArt(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 2, 1))
+	img.SetGray(0, 0, color.Gray{0})
+	img.SetGray(1, 0, color.Gray{255})
+
+	out := TransparentLineArt(img)
+	if c := out.NRGBAAt(0, 0); c.A != 255 {
+		t.Fatalf("Black line pixel has alpha %d, expected 255\n", c.A)
+	}
+	if c := out.NRGBAAt(1, 0); c.A != 0 {
+		t.Fatalf("White background pixel has alpha %d, expected 0\n", c.A)
+	}
+}
@@ -0,0 +1,208 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// silhouetteSampleSize is the number of pixels sampled to estimate the
+// silhouette score. The score needs distances between every pair of sampled
+// pixels, so using the whole image would be far too slow.
+const silhouetteSampleSize = 1000
+
+// KScore records how well clustering an image into K colours fits it.
+type KScore struct {
+	K int
+	// Cost is the k-means cost (mean squared distance to nearest mean).
+	Cost float64
+	// Silhouette is the mean silhouette score over a sample of pixels, from
+	// -1 (poorly clustered) to 1 (well separated clusters).
+	Silhouette float64
+}
+
+// sampleEntries returns the histogram entries standing for up to n pixels
+// chosen at random from the image, so that samples are the same features as
+// are clustered, including positions when clustering with spatial features.
+func sampleEntries(img *image.RGBA, h *ColourHistogram, n int, rng *rand.Rand) []ColourCount {
+	bounds := img.Bounds()
+	pixels := bounds.Dx() * bounds.Dy()
+	if n > pixels {
+		n = pixels
+	}
+
+	samples := make([]ColourCount, n)
+	for i, idx := range rng.Perm(pixels)[:n] {
+		x, y := bounds.Min.X+idx%bounds.Dx(), bounds.Min.Y+idx/bounds.Dx()
+		samples[i] = h.Colours[h.EntryAt(x, y, img.RGBAAt(x, y))]
+	}
+	return samples
+}
+
+// featureDist returns the distance between two histogram entries, including
+// the distance between their positions when clustering with spatial features.
+func featureDist(a, b ColourCount) float64 {
+	dx, dy := a.Pos[0]-b.Pos[0], a.Pos[1]-b.Pos[1]
+	return math.Sqrt(sqDist(a.Coords, b.Coords) + dx*dx + dy*dy)
+}
+
+// SilhouetteScore returns the mean silhouette of the sampled histogram entries
+// under the clustering. For each sample, a is its mean distance to other
+// samples in the same cluster and b the smallest mean distance to the samples
+// of another cluster; its silhouette is (b - a) / max(a, b).
+func (kmc *KMeansClusters) SilhouetteScore(samples []ColourCount) float64 {
+	labels := make([]int, len(samples))
+	sizes := make([]int, kmc.K)
+	for i, s := range samples {
+		labels[i] = -1
+		best := math.MaxFloat64
+		for mIdx := 0; mIdx < kmc.K; mIdx++ {
+			if dist := kmc.entryDist(s, mIdx); dist < best {
+				best = dist
+				labels[i] = mIdx
+			}
+		}
+		sizes[labels[i]]++
+	}
+
+	total := 0.0
+	distSums := make([]float64, kmc.K)
+
+	for i, s := range samples {
+		// A point alone in its cluster has a silhouette of zero by convention
+		if sizes[labels[i]] <= 1 {
+			continue
+		}
+
+		for idx := range distSums {
+			distSums[idx] = 0
+		}
+		for j, other := range samples {
+			if i != j {
+				distSums[labels[j]] += featureDist(s, other)
+			}
+		}
+
+		a := distSums[labels[i]] / float64(sizes[labels[i]]-1)
+		b := math.MaxFloat64
+		for mIdx := 0; mIdx < kmc.K; mIdx++ {
+			if mIdx != labels[i] && sizes[mIdx] > 0 {
+				b = math.Min(b, distSums[mIdx]/float64(sizes[mIdx]))
+			}
+		}
+		if b == math.MaxFloat64 {
+			continue
+		}
+
+		if m := math.Max(a, b); m > 0 {
+			total += (b - a) / m
+		}
+	}
+
+	return total / float64(len(samples))
+}
+
+// ElbowK returns the k at the "elbow" of the cost curve: the point lying
+// farthest from the straight line joining the first and last points, once both
+// axes are scaled to the range 0-1. It returns 0 if there are no scores.
+func ElbowK(scores []KScore) int {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	first, last := scores[0], scores[len(scores)-1]
+	if len(scores) < 3 || first.Cost == last.Cost {
+		return first.K
+	}
+
+	bestK := first.K
+	bestDist := -1.0
+
+	for _, s := range scores {
+		x := float64(s.K-first.K) / float64(last.K-first.K)
+		y := (s.Cost - last.Cost) / (first.Cost - last.Cost)
+
+		// Distance below the line from (0, 1) to (1, 0)
+		dist := (1 - x - y) / math.Sqrt2
+		if dist > bestDist {
+			bestDist = dist
+			bestK = s.K
+		}
+	}
+
+	return bestK
+}
+
+// SilhouetteK returns the k with the highest silhouette score, or 0 if there
+// are no scores.
+func SilhouetteK(scores []KScore) int {
+	if len(scores) == 0 {
+		return 0
+	}
+
+	best := scores[0]
+	for _, s := range scores[1:] {
+		if s.Silhouette > best.Silhouette {
+			best = s
+		}
+	}
+	return best.K
+}
+
+// ChooseK clusters the image with each k from opts.MinK to opts.MaxK and picks
+// the best, using either the elbow of the cost curve or the silhouette score,
+// as selected by opts.KMethod. It returns the clustering with the chosen k and
+// the scores for each k tried.
+func ChooseK(img *image.RGBA, opts KMeansOptions) (*KMeansClusters, []KScore) {
+	// Silhouette scores need at least two clusters to compare, and a palette
+	// can hold at most 256 colours
+	minK, maxK := paletteSize(max(opts.MinK, 2)), paletteSize(opts.MaxK)
+	if maxK < minK {
+		maxK = minK
+	}
+
+	// Fix the seed, so that every run below can be reproduced together
+	if opts.Seed == 0 {
+		opts.Seed = time.Now().UnixNano()
+	}
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	h := kMeansHistogram(img, opts)
+	samples := sampleEntries(img, h, silhouetteSampleSize, rng)
+
+	var scores []KScore
+	var clusterings []*KMeansClusters
+	for k := minK; k <= maxK; k++ {
+		opts.K = k
+		kmc := KMeansHistogramClustering(h, opts)
+		clusterings = append(clusterings, kmc)
+		scores = append(scores, KScore{
+			K:          k,
+			Cost:       kmc.CostVal,
+			Silhouette: kmc.SilhouetteScore(samples),
+		})
+	}
+
+	var chosen int
+	switch opts.KMethod {
+	case "elbow":
+		chosen = ElbowK(scores)
+	default:
+		opts.KMethod = "silhouette"
+		chosen = SilhouetteK(scores)
+	}
+
+	fmt.Printf("\n%4s %14s %12s\n", "k", "cost", "silhouette")
+	for _, s := range scores {
+		marker := ""
+		if s.K == chosen {
+			marker = " <-"
+		}
+		fmt.Printf("%4d %14.2f %12.4f%s\n", s.K, s.Cost, s.Silhouette, marker)
+	}
+	fmt.Printf("Chose k = %v by %v method\n\n", chosen, opts.KMethod)
+
+	return clusterings[chosen-minK], scores
+}
@@ -0,0 +1,125 @@
+package cic
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestElbowK(t *testing.T) {
+	tests := []struct {
+		name  string
+		costs []float64
+		want  int
+	}{
+		{"sharp_elbow", []float64{100, 20, 10, 8, 7, 6}, 2},
+		{"late_elbow", []float64{100, 90, 80, 20, 15, 10}, 4},
+		{"flat", []float64{50, 50, 50, 50}, 1},
+		{"too_few", []float64{100, 10}, 1},
+		{"empty", nil, 0},
+	}
+	for _, test := range tests {
+		var scores []KScore
+		for i, cost := range test.costs {
+			scores = append(scores, KScore{K: i + 1, Cost: cost})
+		}
+		if got := ElbowK(scores); got != test.want {
+			t.Errorf("ElbowK for %s chose %v, expected %v\n", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSilhouetteK(t *testing.T) {
+	scores := []KScore{{K: 2, Silhouette: 0.4}, {K: 3, Silhouette: 0.7}, {K: 4, Silhouette: 0.7}, {K: 5, Silhouette: 0.1}}
+	if got := SilhouetteK(scores); got != 3 {
+		t.Errorf("SilhouetteK chose %v, expected 3\n", got)
+	}
+	if got := SilhouetteK(nil); got != 0 {
+		t.Errorf("SilhouetteK of no scores chose %v, expected 0\n", got)
+	}
+}
+
+func TestSilhouetteScore(t *testing.T) {
+	samples := []ColourCount{
+		{Coords: Mean{0, 0, 0}},
+		{Coords: Mean{0, 0, 0}},
+		{Coords: Mean{200, 200, 200}},
+		{Coords: Mean{200, 200, 200}},
+	}
+
+	kmc := InitKMeans(2)
+	kmc.Means[0] = Mean{0, 0, 0}
+	kmc.Means[1] = Mean{200, 200, 200}
+	if got := kmc.SilhouetteScore(samples); got != 1 {
+		t.Errorf("Separated clusters scored %v, expected 1\n", got)
+	}
+
+	kmc = InitKMeans(1)
+	if got := kmc.SilhouetteScore(samples); got != 0 {
+		t.Errorf("A single cluster scored %v, expected 0\n", got)
+	}
+
+	// With spatial features, clusters of one colour are told apart by their
+	// positions
+	spatial := []ColourCount{
+		{Pos: [2]float64{0, 0}},
+		{Pos: [2]float64{0, 0}},
+		{Pos: [2]float64{100, 0}},
+		{Pos: [2]float64{100, 0}},
+	}
+	kmc = InitKMeans(2)
+	kmc.MeanPos[1] = [2]float64{100, 0}
+	if got := kmc.SilhouetteScore(spatial); got != 1 {
+		t.Errorf("Spatially separated clusters scored %v, expected 1\n", got)
+	}
+}
+
+func TestChooseK(t *testing.T) {
+	colours := []color.RGBA{
+		{255, 0, 0, 255},
+		{0, 0, 255, 255},
+		{255, 255, 255, 255},
+		{0, 0, 0, 255},
+	}
+	tests := []struct {
+		method string
+		n      int
+	}{
+		{"silhouette", 2},
+		{"silhouette", 3},
+		{"silhouette", 4},
+		{"elbow", 3},
+	}
+	for _, test := range tests {
+		opts := DefaultKMeansOptions(0)
+		opts.MinK, opts.MaxK = 2, 6
+		opts.KMethod = test.method
+		opts.Seed = 42
+
+		kmc, scores := ChooseK(blockImage(5, colours[:test.n]...), opts)
+		if len(scores) != 5 {
+			t.Fatalf("Expected scores for k from 2 to 6, got %v\n", scores)
+		}
+		if kmc.K != test.n {
+			t.Errorf("%v method chose k = %v for %v colours\n", test.method, kmc.K, test.n)
+			continue
+		}
+		// The clustering returned is the one which was scored
+		if chosen := scores[kmc.K-opts.MinK]; kmc.CostVal != chosen.Cost {
+			t.Errorf("%v method returned a clustering of cost %v, scored as %v\n",
+				test.method, kmc.CostVal, chosen.Cost)
+		}
+	}
+}
+
+func TestChooseKPaletteSize(t *testing.T) {
+	// Even if asked for more, no more colours are tried than a palette holds
+	opts := DefaultKMeansOptions(0)
+	opts.MinK, opts.MaxK = 300, 300
+	opts.Restarts = 1
+	opts.Seed = 42
+
+	kmc, scores := ChooseK(blockImage(5, color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}), opts)
+	if len(scores) != 1 || kmc.K != 256 {
+		t.Errorf("Chose k = %v from %v scores, expected 256 from 1\n", kmc.K, len(scores))
+	}
+}
@@ -0,0 +1,291 @@
+package cic
+
+import (
+	"fmt"
+	"math"
+)
+
+// PathSegment is one piece of a Path, ending at End: a straight line, or a
+// cubic Bézier curve with control points C1 and C2.
+type PathSegment struct {
+	Curve  bool
+	C1, C2 Vec2
+	End    Vec2
+}
+
+// Path is a contour converted for vector output: simplified, and optionally
+// fitted with curves. Strength is the contour's average edge strength, over
+// all its points before simplification.
+type Path struct {
+	Start    Vec2
+	Segments []PathSegment
+	Closed   bool
+	Strength float64
+}
+
+// PathOptions controls how contours are converted to paths.
+type PathOptions struct {
+	// Simplify is the simplification method: "rdp" (Ramer-Douglas-Peucker),
+	// "visvalingam" (Visvalingam-Whyatt) or "none".
+	Simplify string
+	// Tolerance is how far, in pixels, the simplified line and fitted curves
+	// may stray from the traced points.
+	Tolerance float64
+	// Smooth fits cubic Bézier curves through the simplified points.
+	Smooth bool
+	// CornerAngle is the smallest turn, in degrees, at a point which is kept
+	// as a sharp corner when fitting curves.
+	CornerAngle float64
+}
+
+// SimplifyMethods lists the values accepted for PathOptions.Simplify.
+var SimplifyMethods = []string{"rdp", "visvalingam", "none"}
+
+// ValidateSimplify checks that method is a known simplification method.
+func ValidateSimplify(method string) error {
+	for _, m := range SimplifyMethods {
+		if method == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown simplification method %q (valid options are %v)", method, SimplifyMethods)
+}
+
+// ContourPath simplifies a contour and, if opts.Smooth is set, fits curves to
+// it, returning the resulting path. The contour must have at least 2 points.
+func ContourPath(c Contour, opts PathOptions) Path {
+	strength := meanStrength(c)
+	switch opts.Simplify {
+	case "rdp":
+		c = SimplifyRDP(c, opts.Tolerance)
+	case "visvalingam":
+		c = SimplifyVisvalingam(c, opts.Tolerance)
+	default:
+		c = dropCollinear(c)
+	}
+
+	pts := make([]Vec2, len(c.Points))
+	for i, p := range c.Points {
+		pts[i] = p.Pos()
+	}
+	path := Path{Start: pts[0], Closed: c.Closed, Strength: strength}
+
+	if !opts.Smooth || len(pts) < 3 {
+		for _, p := range pts[1:] {
+			path.Segments = append(path.Segments, PathSegment{End: p})
+		}
+		return path
+	}
+
+	corners := findCorners(pts, c.Closed, opts.CornerAngle)
+
+	if c.Closed {
+		if len(corners) == 0 {
+			// A smooth loop: fit it as one piece from its first point round
+			// to itself, with a shared tangent there
+			loop := append(append([]Vec2(nil), pts...), pts[0])
+			tangent := pts[1].Sub(pts[len(pts)-1]).Normalise()
+			path.Segments = fitCubic(loop, tangent, tangent.Scale(-1), opts.Tolerance)
+			return path
+		}
+
+		// Start the loop at a corner, and end back at it
+		start := corners[0]
+		rotated := append(append([]Vec2(nil), pts[start:]...), pts[:start+1]...)
+		for i := range corners {
+			corners[i] -= start
+		}
+		corners = append(corners, len(rotated)-1)
+		pts = rotated
+		path.Start = pts[0]
+	} else {
+		corners = append(append([]int{0}, corners...), len(pts)-1)
+	}
+
+	for i := 1; i < len(corners); i++ {
+		piece := pts[corners[i-1] : corners[i]+1]
+		left := piece[1].Sub(piece[0]).Normalise()
+		right := piece[len(piece)-2].Sub(piece[len(piece)-1]).Normalise()
+		path.Segments = append(path.Segments, fitCubic(piece, left, right, opts.Tolerance)...)
+	}
+	return path
+}
+
+// findCorners returns the indices of the points at which the line turns by
+// more than cornerAngle degrees. The ends of an open line are not corners.
+func findCorners(pts []Vec2, closed bool, cornerAngle float64) []int {
+	n := len(pts)
+	cosMax := math.Cos(cornerAngle * math.Pi / 180)
+
+	var corners []int
+	for i := range pts {
+		if !closed && (i == 0 || i == n-1) {
+			continue
+		}
+		in := pts[i].Sub(pts[(i+n-1)%n]).Normalise()
+		out := pts[(i+1)%n].Sub(pts[i]).Normalise()
+		if in.Dot(out) < cosMax {
+			corners = append(corners, i)
+		}
+	}
+	return corners
+}
+
+// Schneider's algorithm for fitting cubic Bézier curves to digitised points,
+// from "An Algorithm for Automatically Fitting Digitized Curves", Graphics
+// Gems (1990).
+
+// maxReparameterisations is the number of Newton-Raphson steps taken to
+// improve a nearly good enough fit before splitting it.
+const maxReparameterisations = 4
+
+// bezierPoint evaluates the cubic Bézier curve with control points b at t.
+func bezierPoint(b [4]Vec2, t float64) Vec2 {
+	s := 1 - t
+	return b[0].Scale(s * s * s).
+		Add(b[1].Scale(3 * s * s * t)).
+		Add(b[2].Scale(3 * s * t * t)).
+		Add(b[3].Scale(t * t * t))
+}
+
+// fitCubic fits curves to pts, leaving the first point along tangent left
+// and arriving at the last from the direction of tangent right (both unit
+// vectors pointing into the curve), so that no point is more than tolerance
+// from the curves.
+func fitCubic(pts []Vec2, left, right Vec2, tolerance float64) []PathSegment {
+	first, last := pts[0], pts[len(pts)-1]
+
+	if len(pts) == 2 {
+		d := first.Dist(last) / 3
+		return []PathSegment{{Curve: true, C1: first.Add(left.Scale(d)), C2: last.Add(right.Scale(d)), End: last}}
+	}
+
+	u := chordLengths(pts)
+	bez := generateBezier(pts, u, left, right)
+	maxErr, split := maxError(pts, bez, u)
+
+	tolerance2 := tolerance * tolerance
+	if maxErr <= tolerance2 {
+		return []PathSegment{{Curve: true, C1: bez[1], C2: bez[2], End: bez[3]}}
+	}
+
+	// If the fit is close, try improving the parameterisation before
+	// splitting
+	if maxErr <= 4*tolerance2 {
+		for i := 0; i < maxReparameterisations; i++ {
+			u = reparameterise(pts, bez, u)
+			bez = generateBezier(pts, u, left, right)
+			maxErr, split = maxError(pts, bez, u)
+			if maxErr <= tolerance2 {
+				return []PathSegment{{Curve: true, C1: bez[1], C2: bez[2], End: bez[3]}}
+			}
+		}
+	}
+
+	// Split at the worst point, with a tangent there matching both sides
+	centre := pts[split-1].Sub(pts[split+1]).Normalise()
+	if centre == (Vec2{}) {
+		centre = pts[split-1].Sub(pts[split]).Normalise()
+	}
+	segments := fitCubic(pts[:split+1], left, centre, tolerance)
+	return append(segments, fitCubic(pts[split:], centre.Scale(-1), right, tolerance)...)
+}
+
+// chordLengths parameterises pts by the distance along the line through them,
+// from 0 at the first point to 1 at the last.
+func chordLengths(pts []Vec2) []float64 {
+	u := make([]float64, len(pts))
+	for i := 1; i < len(pts); i++ {
+		u[i] = u[i-1] + pts[i].Dist(pts[i-1])
+	}
+	for i := range u {
+		u[i] /= u[len(u)-1]
+	}
+	return u
+}
+
+// generateBezier finds the curve through the first and last of pts, with the
+// given end tangents, whose points at parameters u best fit pts by least
+// squares.
+func generateBezier(pts []Vec2, u []float64, left, right Vec2) [4]Vec2 {
+	first, last := pts[0], pts[len(pts)-1]
+
+	var c [2][2]float64
+	var x [2]float64
+	for i, t := range u {
+		s := 1 - t
+		a0 := left.Scale(3 * s * s * t)
+		a1 := right.Scale(3 * s * t * t)
+
+		c[0][0] += a0.Dot(a0)
+		c[0][1] += a0.Dot(a1)
+		c[1][1] += a1.Dot(a1)
+
+		tmp := pts[i].Sub(bezierPoint([4]Vec2{first, first, last, last}, t))
+		x[0] += a0.Dot(tmp)
+		x[1] += a1.Dot(tmp)
+	}
+	c[1][0] = c[0][1]
+
+	detC := c[0][0]*c[1][1] - c[1][0]*c[0][1]
+	var alphaL, alphaR float64
+	if detC != 0 {
+		alphaL = (x[0]*c[1][1] - x[1]*c[0][1]) / detC
+		alphaR = (c[0][0]*x[1] - c[1][0]*x[0]) / detC
+	}
+
+	// Fall back on handles a third of the way along the chord if the fit is
+	// degenerate, or would put handles on top of the ends
+	segLength := first.Dist(last)
+	epsilon := 1e-6 * segLength
+	if alphaL < epsilon || alphaR < epsilon {
+		alphaL, alphaR = segLength/3, segLength/3
+	}
+
+	return [4]Vec2{first, first.Add(left.Scale(alphaL)), last.Add(right.Scale(alphaR)), last}
+}
+
+// maxError returns the largest squared distance between a point and the
+// curve at its parameter, and the index of that point.
+func maxError(pts []Vec2, bez [4]Vec2, u []float64) (float64, int) {
+	maxDist, split := 0.0, len(pts)/2
+	for i := 1; i < len(pts)-1; i++ {
+		d := bezierPoint(bez, u[i]).Sub(pts[i])
+		if dist := d.Dot(d); dist > maxDist {
+			maxDist, split = dist, i
+		}
+	}
+	return maxDist, split
+}
+
+// reparameterise moves each parameter in u a Newton-Raphson step closer to
+// the point on the curve nearest its point.
+func reparameterise(pts []Vec2, bez [4]Vec2, u []float64) []float64 {
+	// Control points of the first and second derivatives
+	var d1 [3]Vec2
+	var d2 [2]Vec2
+	for i := range d1 {
+		d1[i] = bez[i+1].Sub(bez[i]).Scale(3)
+	}
+	for i := range d2 {
+		d2[i] = d1[i+1].Sub(d1[i]).Scale(2)
+	}
+
+	out := make([]float64, len(u))
+	for i, t := range u {
+		s := 1 - t
+		q := bezierPoint(bez, t)
+		q1 := d1[0].Scale(s * s).Add(d1[1].Scale(2 * s * t)).Add(d1[2].Scale(t * t))
+		q2 := d2[0].Scale(s).Add(d2[1].Scale(t))
+
+		diff := q.Sub(pts[i])
+		numerator := diff.Dot(q1)
+		denominator := q1.Dot(q1) + diff.Dot(q2)
+		if denominator == 0 {
+			out[i] = t
+		} else {
+			out[i] = t - numerator/denominator
+		}
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package cic
+
+import (
+	"math"
+	"testing"
+)
+
+// pathDist returns the distance from p to the nearest of many points along
+// path.
+func pathDist(path Path, p Vec2) float64 {
+	dist := math.Inf(1)
+	start := path.Start
+	for _, seg := range path.Segments {
+		b := [4]Vec2{start, start, seg.End, seg.End}
+		if seg.Curve {
+			b[1], b[2] = seg.C1, seg.C2
+		}
+		for i := 0; i <= 100; i++ {
+			dist = min(dist, bezierPoint(b, float64(i)/100).Dist(p))
+		}
+		start = seg.End
+	}
+	return dist
+}
+
+func TestContourPath(t *testing.T) {
+	// A circle of radius 20, traced as whole pixels
+	var circle Contour
+	circle.Closed = true
+	for a := 0; a < 360; a += 3 {
+		theta := float64(a) * math.Pi / 180
+		circle.Points = append(circle.Points, ContourPoint{
+			math.Round(30 + 20*math.Cos(theta)), math.Round(30 + 20*math.Sin(theta)), 1,
+		})
+	}
+
+	opts := PathOptions{Simplify: "rdp", Tolerance: 1, Smooth: true, CornerAngle: 60}
+	path := ContourPath(circle, opts)
+	if !path.Closed || len(path.Segments) > 12 {
+		t.Fatalf("Circle fitted with %d segments, expected a closed path of at most 12\n", len(path.Segments))
+	}
+	for _, p := range circle.Points {
+		if d := pathDist(path, p.Pos()); d > 2*opts.Tolerance {
+			t.Fatalf("Point %v is %v from the fitted circle, expected at most %v\n", p, d, 2*opts.Tolerance)
+		}
+	}
+
+	// A V shape keeps a sharp corner at its point
+	v := Contour{Points: []ContourPoint{{0, 0, 1}, {5, 10, 1}, {10, 20, 1}, {15, 10, 1}, {20, 0, 1}}}
+	path = ContourPath(v, opts)
+	corner := false
+	for _, seg := range path.Segments {
+		if seg.End == (Vec2{10, 20}) {
+			corner = true
+		}
+	}
+	if !corner {
+		t.Fatalf("V shape fitted with %v, expected a segment ending at its corner\n", path.Segments)
+	}
+}
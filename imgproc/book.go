@@ -0,0 +1,175 @@
+package cic
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// BookOptions controls the pages of a colouring book around its sheets.
+type BookOptions struct {
+	// Title is set on a cover page. With no title there is no cover.
+	Title string
+	// PageNumbers numbers the pages after the cover at their foot.
+	PageNumbers bool
+	// Titles sets a title above each sheet, from its file name.
+	Titles bool
+	// Index adds contact sheets after the cover, showing a thumbnail of
+	// each sheet with its title and page number.
+	Index bool
+}
+
+const (
+	bookTitleSize      = 18
+	bookCoverTitleSize = 36
+	bookNumberSize     = 10
+	bookIndexTextSize  = 9
+	bookIndexColumns   = 3
+	bookIndexRows      = 4
+)
+
+// TitleFromFilename makes a title for a sheet from the name of its image
+// file, without directory or extension and with underscores and hyphens as
+// spaces.
+func TitleFromFilename(filename string) string {
+	name := filepath.Base(filename)
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.Join(strings.FieldsFunc(name, func(r rune) bool {
+		return r == '_' || r == '-' || r == ' '
+	}), " ")
+}
+
+// drawCentredText sets text centred on x, shrinking it from size points if
+// needed to fit within maxWidth.
+func drawCentredText(page *PDFPage, text string, x, y, size, maxWidth float64) {
+	if w := TextWidth(text, size); w > maxWidth {
+		size *= maxWidth / w
+	}
+	page.DrawText(text, x-TextWidth(text, size)/2, y, size)
+}
+
+// bookSheet is a sheet of a book, with its title and size in pixels.
+type bookSheet struct {
+	xObject       PDFXObject
+	title         string
+	width, height int
+	page          int
+}
+
+// MakeBook runs the pipeline on each image file in filenames, and writes the
+// colouring sheets to a PDF book, one to a page laid out by opts.PDF, with
+// the pages around them set by book.
+func MakeBook(filenames []string, outputFilename string, opts ColouringOptions, book BookOptions) {
+	doc := NewPDFDocument()
+	// The cover and index are portrait, unless landscape is asked for
+	coverWidth, coverHeight := opts.PDF.PageSize(1, 1)
+	margin := opts.PDF.Margin * 72 / 25.4
+
+	if book.Title != "" {
+		cover := doc.AddPage(coverWidth, coverHeight)
+		drawCentredText(cover, book.Title, coverWidth/2, coverHeight*0.4,
+			bookCoverTitleSize, coverWidth-2*margin)
+	}
+
+	// Index pages go before the sheets, but are filled in once the sheets'
+	// pages are known
+	perIndexPage := bookIndexColumns * bookIndexRows
+	var indexPages []*PDFPage
+	if book.Index {
+		for i := 0; i < (len(filenames)+perIndexPage-1)/perIndexPage; i++ {
+			page := doc.AddPage(coverWidth, coverHeight)
+			indexPages = append(indexPages, page)
+		}
+	}
+
+	var sheets []bookSheet
+	for i, filename := range filenames {
+		fmt.Printf("Making sheet %d of %d, from \"%v\"\n", i+1, len(filenames), filename)
+		reader, err := os.Open(filename)
+		if err != nil {
+			log.Fatal(err)
+		}
+		img, _, err := DecodeImage(reader)
+		reader.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		img = PrepareImage(img, opts.Resize)
+		bounds := img.Bounds()
+
+		sheet := bookSheet{
+			xObject: AddColouring(doc, img, opts),
+			title:   TitleFromFilename(filename),
+			width:   bounds.Dx(),
+			height:  bounds.Dy(),
+		}
+
+		pageWidth, pageHeight := opts.PDF.PageSize(sheet.width, sheet.height)
+		page := doc.AddPage(pageWidth, pageHeight)
+		sheet.page = len(doc.pages)
+
+		// Leave room for the title above the sheet and number below it
+		area := PDFRect{margin, margin, pageWidth - 2*margin, pageHeight - 2*margin}
+		if book.Titles {
+			drawCentredText(page, sheet.title, pageWidth/2, margin+bookTitleSize,
+				bookTitleSize, area.Width)
+			area.Y += 2 * bookTitleSize
+			area.Height -= 2 * bookTitleSize
+		}
+		if book.PageNumbers {
+			area.Height -= 2 * bookNumberSize
+		}
+		page.Draw(sheet.xObject, fitRect(sheet.width, sheet.height, area, 72/opts.PDF.DPI, opts.PDF.ScaleToFit))
+
+		sheets = append(sheets, sheet)
+	}
+
+	if book.Index {
+		// Contact sheets: a grid of thumbnails, each with its title and page
+		for i, sheet := range sheets {
+			page := indexPages[i/perIndexPage]
+			slot := i % perIndexPage
+			cellWidth := (coverWidth - 2*margin) / bookIndexColumns
+			cellHeight := (coverHeight - 2*margin - 2*bookNumberSize) / bookIndexRows
+			cell := PDFRect{
+				margin + float64(slot%bookIndexColumns)*cellWidth,
+				margin + float64(slot/bookIndexColumns)*cellHeight,
+				cellWidth, cellHeight,
+			}
+
+			thumb := PDFRect{cell.X + 6, cell.Y + 6, cell.Width - 12, cell.Height - 12 - 2*bookIndexTextSize}
+			thumb = fitRect(sheet.width, sheet.height, thumb, 0, true)
+			page.Draw(sheet.xObject, thumb)
+			page.StrokeRect(thumb, 0.5, 0.75)
+
+			label := sheet.title + " – " + strconv.Itoa(sheet.page)
+			drawCentredText(page, label, cell.X+cell.Width/2, thumb.Y+thumb.Height+1.5*bookIndexTextSize,
+				bookIndexTextSize, cell.Width-12)
+		}
+	}
+
+	if book.PageNumbers {
+		for i, page := range doc.pages {
+			if i == 0 && book.Title != "" {
+				continue
+			}
+			drawCentredText(page, strconv.Itoa(i+1), page.Width/2, page.Height-margin,
+				bookNumberSize, page.Width)
+		}
+	}
+
+	fmt.Printf("Saving to output file, \"%v\"...", outputFilename)
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outputFile.Close()
+
+	if err := doc.Write(outputFile); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf(" Done (%d pages)\n", len(doc.pages))
+}
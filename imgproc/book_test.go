@@ -0,0 +1,128 @@
+package cic
+
+import (
+	"bytes"
+	"compress/zlib"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestTitleFromFilename(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"tractor.jpg":                     "tractor",
+		"frames/Peppa_Pig-helicopter.png": "Peppa Pig helicopter",
+		"postman  pat__van.jpeg":          "postman pat van",
+	} {
+		if title := TitleFromFilename(filename); title != expected {
+			t.Fatalf("Title from %q is %q, expected %q\n", filename, title, expected)
+		}
+	}
+}
+
+// pdfPageTexts returns the strings set on each page of a PDF written by
+// PDFDocument, in page order.
+func pdfPageTexts(t *testing.T, pdf []byte) [][]string {
+	var pages [][]string
+	for _, m := range regexp.MustCompile(`/Type /Page /Parent .*/Contents (\d+) 0 R`).FindAllSubmatch(pdf, -1) {
+		obj := regexp.MustCompile(`(?s)\n` + string(m[1]) + ` 0 obj\n<< .*?/Length (\d+) >>\nstream\n`)
+		loc := obj.FindSubmatchIndex(pdf)
+		if loc == nil {
+			t.Fatalf("PDF has no content stream %s\n", m[1])
+		}
+		length, _ := strconv.Atoi(string(pdf[loc[2]:loc[3]]))
+		zr, err := zlib.NewReader(bytes.NewReader(pdf[loc[1] : loc[1]+length]))
+		if err != nil {
+			t.Fatalf("Reading content stream %s failed: %v\n", m[1], err)
+		}
+		content, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("Reading content stream %s failed: %v\n", m[1], err)
+		}
+
+		var texts []string
+		for _, s := range regexp.MustCompile(`\(((?:[^\\)]|\\.)*)\) Tj`).FindAllSubmatch(content, -1) {
+			texts = append(texts, string(s[1]))
+		}
+		pages = append(pages, texts)
+	}
+	return pages
+}
+
+func TestMakeBook(t *testing.T) {
+	// Three sheets, of a dark square on white, one of them wide
+	dir := t.TempDir()
+	titles := []string{"apple", "big bus", "cat"}
+	var filenames []string
+	for i, name := range []string{"apple.png", "big_bus.png", "cat.png"} {
+		img := image.NewGray(image.Rect(0, 0, 60+40*i, 60))
+		for y := 0; y < 60; y++ {
+			for x := 0; x < 60+40*i; x++ {
+				if x < 20 || x >= 40 || y < 20 || y >= 40 {
+					img.SetGray(x, y, color.Gray{255})
+				}
+			}
+		}
+		filename := filepath.Join(dir, name)
+		f, err := os.Create(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, img); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		filenames = append(filenames, filename)
+	}
+
+	output := filepath.Join(dir, "book.pdf")
+	MakeBook(filenames, output, DefaultColouringOptions(), BookOptions{
+		Title:       "Favourites",
+		PageNumbers: true,
+		Titles:      true,
+		Index:       true,
+	})
+	pdf, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cover, an index page, and a page for each sheet
+	if !bytes.Contains(pdf, []byte("/Count 5")) {
+		t.Fatalf("Book page tree does not count 5 pages\n")
+	}
+	pages := pdfPageTexts(t, pdf)
+	if len(pages) != 5 {
+		t.Fatalf("Found %d pages in book, expected 5\n", len(pages))
+	}
+	if !slices.Equal(pages[0], []string{"Favourites"}) {
+		t.Errorf("Cover has text %q, expected only its title\n", pages[0])
+	}
+
+	// Every page after the cover is numbered, and the index gives the number
+	// printed on each sheet's page
+	for i, texts := range pages[1:] {
+		number := strconv.Itoa(i + 2)
+		if len(texts) == 0 || texts[len(texts)-1] != number {
+			t.Errorf("Page %v has text %q, expected to end with its number\n", number, texts)
+		}
+	}
+	for i, title := range titles {
+		page := pages[2+i]
+		if !slices.Contains(page, title) {
+			t.Errorf("Page %v has text %q, expected the title %q\n", i+3, page, title)
+		}
+		number := page[len(page)-1]
+		label := string(encodeText(title + " – " + number))
+		if !slices.Contains(pages[1], label) {
+			t.Errorf("Index has text %q, expected %q\n", pages[1], label)
+		}
+	}
+}
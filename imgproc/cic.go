@@ -15,11 +15,12 @@ import (
 	"image"
 	"image/color"
 	"image/draw"
-	"image/jpeg"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"log"
 	"math"
 	"os"
+	"slices"
+	"strings"
 
 	_ "image/png"
 )
@@ -35,13 +36,15 @@ func RgbToGray(c color.RGBA) color.Gray {
 func GrayscaleImage(img image.Image) *image.Gray {
 	bounds := img.Bounds()
 
+	// Transparent pixels are composited onto white
 	r := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
-	draw.Draw(r, r.Bounds(), img, bounds.Min, draw.Src)
+	draw.Draw(r, r.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(r, r.Bounds(), img, bounds.Min, draw.Over)
 
 	g := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
 
-	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
-		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
 			c, ok := r.At(x, y).(color.RGBA)
 			if !ok {
 				log.Fatal()
@@ -447,52 +450,177 @@ func SobelFilter(img *image.Gray) *ImageGradients {
 	return ig
 }
 
-func ConvertImageToColouring(
-	filename string,
-	outputFilename string,
-	sigma float64,
-	upperThreshold int,
-	lowerThreshold int,
-	nonMaxSuppDist int,
-	thickerThreshold int,
-	thinnerThreshold int,
-) {
-	fmt.Print("Reading in file...")
+// ColouringOptions holds the parameters of the edge detection pipeline which
+// turns an image into a colouring sheet.
+type ColouringOptions struct {
+	Sigma                     float64
+	UpperThreshold            int
+	LowerThreshold            int
+	NonMaxSuppressionDistance int
+	ThickerThreshold          int
+	ThinnerThreshold          int
+	// Thin reduces edges to lines one pixel wide before they are stroked, so
+	// that line width depends only on the thickening stage.
+	Thin bool
+	// Prune is the length in pixels of the longest spur pruned from lines, and
+	// MinLineLength the fewest pixels in a line which is kept. Zero turns
+	// either off.
+	Prune         int
+	MinLineLength int
+	// Gaps controls the bridging of gaps from the end of an edge to another
+	// edge, so that shapes are closed. A MaxGap of zero leaves gaps open.
+	// Gaps are only bridged from the ends of thinned lines, so need Thin.
+	Gaps GapOptions
+	// Morphology lists operations applied in turn to the edges, drawn light
+	// on dark, before they are stroked.
+	Morphology []MorphologyOp
+	// MinWidth and MaxWidth are the widths in pixels of lines drawn for the
+	// weakest and strongest edges. A MaxWidth of zero instead thickens lines
+	// in two steps, by ThickerThreshold and ThinnerThreshold.
+	MinWidth float64
+	MaxWidth float64
+	// Format is the format of the output file: one of ImageFormats, "svg"
+	// to trace the edges into lines and write them as vector paths, or "pdf"
+	// to print the sheet on a page, laid out by PDF. If empty, the format is
+	// chosen by the output file's extension.
+	Format string
+	PDF    PDFOptions
+	// Vector controls how lines traced for SVG output are simplified and
+	// fitted with curves, and SVGBackground fills SVG output with white
+	// behind them.
+	Vector        PathOptions
+	SVGBackground bool
+	// ReportRegions prints the number and sizes of the closed regions of the
+	// finished sheet.
+	ReportRegions bool
+	// Background is the colour transparent parts of the image are composited
+	// onto before edges are found. AlphaOutline adds the outline of the
+	// image's opaque parts to the edges.
+	Background   color.Color
+	AlphaOutline bool
+	// Transparent writes the sheet with a transparent background rather than
+	// white, in one of TransparentFormats.
+	Transparent bool
+	// Resize crops and resizes the image before it is blurred.
+	Resize ResizeOptions
+	// Scales, if more than one, are the standard deviations of blur at which
+	// edges are found instead of Sigma, keeping those which persist over at
+	// least MinScales of them. The thresholds and non-max suppression
+	// distance apply at every scale.
+	Scales    []float64
+	MinScales int
+}
 
-	reader, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
+func DefaultColouringOptions() ColouringOptions {
+	return ColouringOptions{
+		Sigma:                     1.0,
+		UpperThreshold:            100,
+		LowerThreshold:            10,
+		NonMaxSuppressionDistance: 1,
+		ThickerThreshold:          50,
+		ThinnerThreshold:          150,
+		Thin:                      true,
+		MinWidth:                  1,
+		MaxWidth:                  4,
+		SVGBackground:             true,
+		Vector:                    PathOptions{Simplify: "rdp", Tolerance: 1, CornerAngle: 60},
+		PDF:                       DefaultPDFOptions(),
+		Gaps:                      GapOptions{MaxAngle: 30},
+		Background:                color.White,
+		Resize:                    ResizeOptions{Filter: "lanczos"},
+		MinScales:                 2,
 	}
-	defer reader.Close()
-
-	fmt.Print(" Done\n")
-	fmt.Print("Decoding file to Image...")
+}
 
-	img, _, err := image.Decode(reader)
-	if err != nil {
-		log.Fatal(err)
+// ColouringEdges runs the edge detection stages of the pipeline on img,
+// returning the edges found, drawn light on black with their strength as gray
+// level.
+func ColouringEdges(img image.Image, opts ColouringOptions) *image.Gray {
+	original := img
+	hasAlpha := HasAlpha(img)
+	if hasAlpha {
+		fmt.Print("Compositing transparent image onto background...")
+		bg := opts.Background
+		if bg == nil {
+			bg = color.White
+		}
+		img = CompositeImage(img, bg)
+		fmt.Print(" Done\n")
 	}
-	fmt.Print(" Done\n")
-
 	fmt.Print("Converting to grayscale image...")
 	grayImg := GrayscaleImage(img)
 	fmt.Print(" Done\n")
-	fmt.Print("Applying Gaussian blur...")
-	grayImg = GaussianBlur(grayImg, sigma)
-	fmt.Print(" Done\n")
-	fmt.Print("Applying Sobel filter...")
-	ig := SobelFilter(grayImg)
-	fmt.Print(" Done\n")
-	fmt.Print("Applying non-max suppression...")
-	ig = ig.NonmaxSuppression(nonMaxSuppDist)
-	fmt.Print(" Done\n")
-	fmt.Print("Applying threshold suppression...")
-	// ig = ig.BasicThresholdSuppression()
-	ig = ig.LineFollowingThresholdSuppression(upperThreshold, lowerThreshold)
-	fmt.Print(" Done\n")
+	var ig *ImageGradients
+	if len(opts.Scales) > 1 {
+		ig = ScaleSpaceEdges(grayImg, opts)
+	} else {
+		fmt.Print("Applying Gaussian blur...")
+		grayImg = GaussianBlur(grayImg, opts.Sigma)
+		fmt.Print(" Done\n")
+		fmt.Print("Applying Sobel filter...")
+		ig = SobelFilter(grayImg)
+		fmt.Print(" Done\n")
+		fmt.Print("Applying non-max suppression...")
+		ig = ig.NonmaxSuppression(opts.NonMaxSuppressionDistance)
+		fmt.Print(" Done\n")
+		fmt.Print("Applying threshold suppression...")
+		// ig = ig.BasicThresholdSuppression()
+		ig = ig.LineFollowingThresholdSuppression(opts.UpperThreshold, opts.LowerThreshold)
+		fmt.Print(" Done\n")
+	}
+	if opts.AlphaOutline && hasAlpha {
+		fmt.Print("Adding outline of opaque parts...")
+		ig = ig.AddAlphaOutline(original)
+		fmt.Print(" Done\n")
+	}
+	if opts.Thin {
+		fmt.Print("Thinning edges...")
+		ig = ig.Thin()
+		fmt.Print(" Done\n")
+	}
+	if opts.Prune > 0 {
+		fmt.Printf("Pruning spurs of up to %v pixels...", opts.Prune)
+		ig = ig.PruneSpurs(opts.Prune)
+		fmt.Print(" Done\n")
+	}
+	if opts.MinLineLength > 0 {
+		fmt.Printf("Removing lines shorter than %v pixels...", opts.MinLineLength)
+		ig = ig.RemoveShortLines(opts.MinLineLength)
+		fmt.Print(" Done\n")
+	}
+	if opts.Gaps.MaxGap > 0 {
+		fmt.Printf("Bridging gaps of up to %v pixels within %v° of each line's direction...",
+			opts.Gaps.MaxGap, opts.Gaps.MaxAngle)
+		ig = ig.BridgeGaps(opts.Gaps)
+		fmt.Print(" Done\n")
+	}
 	fmt.Print("Converting edge gradients to grayscale image...")
 	grayImg = ig.GrayscaleImage()
 	fmt.Print(" Done\n")
+	for _, op := range opts.Morphology {
+		fmt.Printf("Applying morphological %v...", op.Name)
+		grayImg = op.Apply(grayImg)
+		fmt.Print(" Done\n")
+	}
+
+	return grayImg
+}
+
+// ColouringImage runs the edge detection pipeline on img, returning a
+// colouring sheet with black lines on white.
+func ColouringImage(img image.Image, opts ColouringOptions) *image.Gray {
+	return LineArt(ColouringEdges(img, opts), opts)
+}
+
+// LineArt draws edges found by ColouringEdges as black lines on white.
+func LineArt(grayImg *image.Gray, opts ColouringOptions) *image.Gray {
+	if opts.MaxWidth > 0 {
+		fmt.Printf("Stroking lines %v to %v pixels wide by edge strength...", opts.MinWidth, opts.MaxWidth)
+		grayImg = StrokeLines(grayImg, opts.MinWidth, opts.MaxWidth)
+		fmt.Print(" Done\n")
+		return grayImg
+	}
+
 	fmt.Print("Inverting image to make edges black...")
 	grayImg = InvertGrayscaleImage(grayImg)
 	fmt.Print(" Done\n")
@@ -500,16 +628,148 @@ func ConvertImageToColouring(
 	fmt.Print("Thickening lines based on threshold values:\n")
 	fmt.Printf(
 		"Thicker threshold level: %v\nThinner threshold level: %v\n",
-		thickerThreshold,
-		thinnerThreshold,
+		opts.ThickerThreshold,
+		opts.ThinnerThreshold,
 	)
 	grayImg = ThickenLinesByDarkness(
 		grayImg,
-		uint8(thickerThreshold),
-		uint8(thinnerThreshold),
+		uint8(opts.ThickerThreshold),
+		uint8(opts.ThinnerThreshold),
 	)
 	fmt.Print("Done\n")
 
+	return grayImg
+}
+
+// ColouringFormats lists the formats colouring sheets can be written in.
+var ColouringFormats = append(append([]string(nil), ImageFormats...), "svg", "pdf")
+
+func ConvertImageToColouring(filename string, outputFilename string, opts ColouringOptions) {
+	format := colouringFormat(outputFilename, opts)
+
+	fmt.Print("Reading in file...")
+
+	reader, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	fmt.Print(" Done\n")
+	fmt.Print("Decoding file to Image...")
+
+	img, _, err := DecodeImage(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(" Done\n")
+
+	writeColouring(img, outputFilename, format, opts)
+}
+
+// ConvertFramesToColouring makes a colouring sheet of each frame chosen by
+// sel, such as from an animated GIF or directory of frames opened by
+// OpenAnimation, naming each after outputFilename with the frame's index
+// added.
+func ConvertFramesToColouring(frames Frames, outputFilename string, opts ColouringOptions, sel FrameSelection) {
+	format := colouringFormat(outputFilename, opts)
+	fmt.Printf("Read in %d frames\n", frames.Len())
+
+	if len(sel.Indices) == 0 && sel.Interval == 0 {
+		fmt.Print("Choosing the sharpest frame of each scene...")
+	} else {
+		fmt.Print("Choosing frames...")
+	}
+	indices, err := SelectFrames(frames, sel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf(" Done, %d frames chosen\n", len(indices))
+
+	for _, i := range indices {
+		fmt.Printf("Frame %d:\n", i)
+		img, err := frames.Frame(i)
+		if err != nil {
+			log.Fatal(err)
+		}
+		writeColouring(img, frameFilename(outputFilename, i, frames.Len()), format, opts)
+	}
+}
+
+// colouringFormat returns the format to write a colouring sheet to
+// outputFilename in, checking that it suits the options.
+func colouringFormat(outputFilename string, opts ColouringOptions) string {
+	format, err := OutputFormat(opts.Format, outputFilename, ColouringFormats)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if opts.Transparent && !slices.Contains(TransparentFormats, format) {
+		log.Fatalf("%v output can't have a transparent background (valid formats are %v)",
+			format, strings.Join(TransparentFormats, ", "))
+	}
+	return format
+}
+
+// writeColouring makes a colouring sheet of img and writes it to
+// outputFilename in format.
+func writeColouring(img image.Image, outputFilename string, format string, opts ColouringOptions) {
+	img = PrepareImage(img, opts.Resize)
+
+	switch format {
+	case "svg":
+		writeColouringSVG(img, outputFilename, opts)
+		return
+	case "pdf":
+		writeColouringPDF(img, outputFilename, opts)
+		return
+	}
+
+	grayImg := ColouringImage(img, opts)
+
+	if opts.ReportRegions {
+		fmt.Print(AnalyseRegions(grayImg, lineThreshold))
+	}
+
+	fmt.Printf("Saving to output file, \"%v\"...", outputFilename)
+	var sheet image.Image = grayImg
+	if opts.Transparent {
+		sheet = TransparentLineArt(grayImg)
+	}
+	if err := SaveImage(outputFilename, sheet, format); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(" Done\n")
+}
+
+// traceColouring runs the edge detection stages of the pipeline on img and
+// traces the edges into lines, returning them with the bounds of the image
+// and the range of widths to stroke them.
+func traceColouring(img image.Image, opts ColouringOptions) ([]Contour, image.Rectangle, float64, float64) {
+	edges := ColouringEdges(img, opts)
+
+	if opts.ReportRegions {
+		fmt.Print(AnalyseRegions(LineArt(edges, opts), lineThreshold))
+	}
+
+	fmt.Print("Tracing lines...")
+	contours := TraceContours(edges)
+	fmt.Printf(" Done (%v lines)\n", len(contours))
+
+	// Lines thickened in steps have no width range of their own
+	minWidth, maxWidth := opts.MinWidth, opts.MaxWidth
+	if maxWidth <= 0 {
+		defaults := DefaultColouringOptions()
+		minWidth, maxWidth = defaults.MinWidth, defaults.MaxWidth
+	}
+
+	return contours, edges.Bounds(), minWidth, maxWidth
+}
+
+// writeColouringSVG traces the edges of img into lines and writes them to an
+// SVG file.
+func writeColouringSVG(img image.Image, outputFilename string, opts ColouringOptions) {
+	contours, bounds, minWidth, maxWidth := traceColouring(img, opts)
+
 	fmt.Printf("Saving to output file, \"%v\"...", outputFilename)
 	outputFile, err := os.Create(outputFilename)
 	if err != nil {
@@ -517,23 +777,70 @@ func ConvertImageToColouring(
 	}
 	defer outputFile.Close()
 
-	var imgOptions jpeg.Options
-	imgOptions.Quality = 100
+	err = WriteSVG(outputFile, contours, SVGOptions{
+		Width:      bounds.Dx(),
+		Height:     bounds.Dy(),
+		MinWidth:   minWidth,
+		MaxWidth:   maxWidth,
+		Paths:      opts.Vector,
+		Background: opts.SVGBackground && !opts.Transparent,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(" Done\n")
+}
+
+// AddColouring runs the pipeline on img and adds the colouring sheet to doc,
+// as raster or vector line art by opts.PDF.Vector.
+func AddColouring(doc *PDFDocument, img image.Image, opts ColouringOptions) PDFXObject {
+	if opts.PDF.Vector {
+		contours, bounds, minWidth, maxWidth := traceColouring(img, opts)
+		paths, widths := StrokePaths(contours, minWidth, maxWidth, opts.Vector)
+		return doc.AddPaths(paths, widths, bounds.Dx(), bounds.Dy())
+	}
+
+	grayImg := ColouringImage(img, opts)
+	if opts.ReportRegions {
+		fmt.Print(AnalyseRegions(grayImg, lineThreshold))
+	}
+	return doc.AddImage(grayImg)
+}
+
+// DrawColouringPage adds a page to doc with the colouring sheet of img placed
+// on it by opts.PDF.
+func DrawColouringPage(doc *PDFDocument, img image.Image, opts ColouringOptions) {
+	bounds := img.Bounds()
+	pageWidth, pageHeight := opts.PDF.PageSize(bounds.Dx(), bounds.Dy())
+	sheet := AddColouring(doc, img, opts)
+	doc.AddPage(pageWidth, pageHeight).Draw(sheet, opts.PDF.Place(bounds.Dx(), bounds.Dy(), pageWidth, pageHeight))
+}
+
+// writeColouringPDF writes the colouring sheet of img to a PDF file.
+func writeColouringPDF(img image.Image, outputFilename string, opts ColouringOptions) {
+	doc := NewPDFDocument()
+	DrawColouringPage(doc, img, opts)
+
+	fmt.Printf("Saving to output file, \"%v\"...", outputFilename)
+	outputFile, err := os.Create(outputFilename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer outputFile.Close()
 
-	jpeg.Encode(outputFile, grayImg, &imgOptions)
+	if err := doc.Write(outputFile); err != nil {
+		log.Fatal(err)
+	}
 	fmt.Print(" Done\n")
 }
 
 func main() {
 	fmt.Println("Hello, I'm cic!")
+	opts := DefaultColouringOptions()
+	opts.LowerThreshold = 20
 	ConvertImageToColouring(
 		"./images/postmanpathelicopter.jpg",
 		"./images/postmanpathelicopter-colouring.jpg",
-		1.0,
-		100,
-		20,
-		1,
-		50,
-		150,
+		opts,
 	)
 }
@@ -0,0 +1,105 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+)
+
+// crossings counts the separate runs of edge pixels around (x, y): 1 along a
+// line or at its end, and 3 or more where lines meet.
+func (ig *ImageGradients) crossings(x, y int) int {
+	// Neighbours in order going round the pixel
+	ring := [8]image.Point{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}}
+
+	n := 0
+	for i, off := range ring {
+		next := ring[(i+1)%8]
+		if !ig.isEdge(x+off.X, y+off.Y) && ig.isEdge(x+next.X, y+next.Y) {
+			n++
+		}
+	}
+	return n
+}
+
+// spur follows the line from end until it meets a junction, returning the
+// pixels before the junction. It returns nil if the line ends, or if there are
+// more than maxLength pixels before the junction.
+func (ig *ImageGradients) spur(end image.Point, maxLength int) []image.Point {
+	var path []image.Point
+	visited := map[image.Point]bool{}
+
+	p := end
+	for {
+		if ig.crossings(p.X, p.Y) >= 3 {
+			return path
+		}
+		if len(path) == maxLength {
+			return nil
+		}
+		path = append(path, p)
+		visited[p] = true
+
+		next, found := image.Point{}, false
+		for _, q := range ig.edgeNeighbours(p.X, p.Y) {
+			if !visited[q] {
+				next, found = q, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+		p = next
+	}
+}
+
+// PruneSpurs removes short branches off lines: runs of up to maxLength pixels
+// from a line's end to a junction with another line. Such spurs are left by
+// texture and noise along an edge, and by thinning the corners of thick edges.
+// Lines which don't meet another are left for RemoveShortLines.
+func (ig *ImageGradients) PruneSpurs(maxLength int) *ImageGradients {
+	var spurs [][]image.Point
+	for _, end := range ig.Endpoints() {
+		if path := ig.spur(end, maxLength); len(path) > 0 {
+			spurs = append(spurs, path)
+		}
+	}
+
+	// Remove spurs only once all are found, so that pruning one spur doesn't
+	// turn the junction it met into part of another
+	for _, path := range spurs {
+		for _, p := range path {
+			ig.Value[p.Y][p.X] = 0
+		}
+	}
+
+	fmt.Printf("\nPruned %v spurs\n", len(spurs))
+
+	return ig
+}
+
+// RemoveShortLines removes every 8-connected group of edge pixels with fewer
+// than minLength pixels, such as the fragments of edges found in texture.
+func (ig *ImageGradients) RemoveShortLines(minLength int) *ImageGradients {
+	labels, sizes := LabelComponents(ig.X, ig.Y, 8,
+		func(idx int) bool { return ig.Value[idx/ig.X][idx%ig.X] > 0 },
+		func(a, b int) bool { return true },
+	)
+
+	removed := 0
+	for _, size := range sizes {
+		if size < minLength {
+			removed++
+		}
+	}
+
+	for idx, label := range labels {
+		if label >= 0 && sizes[label] < minLength {
+			ig.Value[idx/ig.X][idx%ig.X] = 0
+		}
+	}
+
+	fmt.Printf("\nRemoved %v of %v lines shorter than %v pixels\n", removed, len(sizes), minLength)
+
+	return ig
+}
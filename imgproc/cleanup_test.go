@@ -0,0 +1,53 @@
+package cic
+
+import "testing"
+
+func TestPruneSpurs(t *testing.T) {
+	// A horizontal line with a 3 pixel spur hanging from its middle, and a
+	// 10 pixel one further along
+	ig := CreateImageGradients(40, 20)
+	for i := 2; i < 38; i++ {
+		ig.Value[5][i] = 100
+	}
+	for j := 6; j <= 8; j++ {
+		ig.Value[j][10] = 100
+	}
+	for j := 6; j <= 15; j++ {
+		ig.Value[j][25] = 100
+	}
+
+	ig.PruneSpurs(5)
+
+	for j := 6; j <= 8; j++ {
+		if ig.Value[j][10] != 0 {
+			t.Fatalf("Short spur pixel (10, %v) was not pruned\n", j)
+		}
+	}
+	for j := 6; j <= 15; j++ {
+		if ig.Value[j][25] == 0 {
+			t.Fatalf("Long spur pixel (25, %v) was pruned\n", j)
+		}
+	}
+	for i := 2; i < 38; i++ {
+		if ig.Value[5][i] == 0 {
+			t.Fatalf("Line pixel (%v, 5) was pruned\n", i)
+		}
+	}
+}
+
+func TestRemoveShortLines(t *testing.T) {
+	ig := CreateImageGradients(20, 10)
+	for i := 2; i < 18; i++ {
+		ig.Value[2][i] = 100
+	}
+	ig.Value[6][4], ig.Value[7][5], ig.Value[7][6] = 100, 100, 100
+
+	ig.RemoveShortLines(5)
+
+	if ig.Value[2][10] == 0 {
+		t.Fatalf("Long line was removed\n")
+	}
+	if ig.Value[6][4] != 0 || ig.Value[7][5] != 0 || ig.Value[7][6] != 0 {
+		t.Fatalf("Short line was not removed\n")
+	}
+}
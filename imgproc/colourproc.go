@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/draw"
 	"image/jpeg"
 	"log"
 	"math"
@@ -13,16 +12,17 @@ import (
 	_ "image/png"
 )
 
-func imageToRGBA(img image.Image) *image.RGBA {
+func imageToRGBA(img image.Image, bg color.Color) *image.RGBA {
 	// check if image already satisfies RGBA type
-	if rgba, ok := img.(*image.RGBA); ok {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Opaque() {
 		return rgba
 	}
 
-	bounds := img.Bounds()
-	rgba := image.NewRGBA(bounds)
-	draw.Draw(rgba, bounds, img, bounds.Min, draw.Src)
-	return rgba
+	// Transparent pixels are composited onto bg, or white if it's nil
+	if bg == nil {
+		bg = color.White
+	}
+	return CompositeImage(img, bg)
 
 }
 
@@ -95,6 +95,14 @@ func GaussianBlurColour(img *image.RGBA, sigma float64) *image.RGBA {
 }
 
 func ColourSobelFilter(img *image.RGBA) *ImageGradients {
+	return ColourSpaceSobelFilter(img, RGBSpace)
+}
+
+// ColourSpaceSobelFilter applies the Sobel operator to each channel of the
+// image's coordinates in the given colour space, and combines the channel
+// gradients by their root sum of squares. In LabSpace this approximates the
+// rate of change of perceived colour difference (ΔE) across the image.
+func ColourSpaceSobelFilter(img *image.RGBA, cs ColourSpace) *ImageGradients {
 	imgSize := img.Bounds().Size()
 
 	skx := CreateSobelKernel("X")
@@ -105,11 +113,21 @@ func ColourSobelFilter(img *image.RGBA) *ImageGradients {
 
 	ig := CreateImageGradients(imgSize.X, imgSize.Y)
 
-	gx := make([]int, 3, 3)
-	gy := make([]int, 3, 3)
+	// Convert every pixel to colour space coordinates up front, rather than
+	// once for each kernel position it falls under.
+	coords := make([][][3]float64, imgSize.Y)
+	for j := 0; j < imgSize.Y; j++ {
+		coords[j] = make([][3]float64, imgSize.X)
+		for i := 0; i < imgSize.X; i++ {
+			coords[j][i] = cs.Coordinates(img.RGBAAt(img.Bounds().Min.X+i, img.Bounds().Min.Y+j))
+		}
+	}
 
-	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
+	gx := make([]float64, 3, 3)
+	gy := make([]float64, 3, 3)
+
+	for y := 0; y < imgSize.Y; y++ {
+		for x := 0; x < imgSize.X; x++ {
 			// Reset values of gx and gy for each pixel
 			for idx := 0; idx < 3; idx++ {
 				gx[idx] = 0.0
@@ -118,42 +136,37 @@ func ColourSobelFilter(img *image.RGBA) *ImageGradients {
 			for j := -sky.Size / 2; j <= sky.Size/2; j++ {
 				n := y + j
 
-				if n < img.Bounds().Min.Y {
-					n = img.Bounds().Min.Y
-				} else if n >= img.Bounds().Max.Y {
-					n = img.Bounds().Max.Y - 1
+				if n < 0 {
+					n = 0
+				} else if n >= imgSize.Y {
+					n = imgSize.Y - 1
 				}
 
 				for i := -skx.Size / 2; i <= skx.Size/2; i++ {
 					m := x + i
 
-					if m < img.Bounds().Min.X {
-						m = img.Bounds().Min.X
-					} else if m >= img.Bounds().Max.X {
-						m = img.Bounds().Max.X - 1
+					if m < 0 {
+						m = 0
+					} else if m >= imgSize.X {
+						m = imgSize.X - 1
 					}
 
 					// get pixel value at (m, n) for easy reference
-					px := img.RGBAAt(m, n)
+					px := coords[n][m]
 
-					// Horizontal edge components
-					gx[0] += int(px.R) * skx.Factors[j+(skx.Size/2)][i+(skx.Size/2)]
-					gx[1] += int(px.G) * skx.Factors[j+(skx.Size/2)][i+(skx.Size/2)]
-					gx[2] += int(px.B) * skx.Factors[j+(skx.Size/2)][i+(skx.Size/2)]
-
-					// Vertical edge components
-					gy[0] += int(px.R) * sky.Factors[j+(sky.Size/2)][i+(sky.Size/2)]
-					gy[1] += int(px.G) * sky.Factors[j+(sky.Size/2)][i+(sky.Size/2)]
-					gy[2] += int(px.B) * sky.Factors[j+(sky.Size/2)][i+(sky.Size/2)]
+					for idx := 0; idx < 3; idx++ {
+						// Horizontal edge components
+						gx[idx] += px[idx] * float64(skx.Factors[j+(skx.Size/2)][i+(skx.Size/2)])
+						// Vertical edge components
+						gy[idx] += px[idx] * float64(sky.Factors[j+(sky.Size/2)][i+(sky.Size/2)])
+					}
 				}
 			}
 
-			// Calculate single gx and gy values for gradient, based on RGB
+			// Calculate single gx and gy values for gradient, based on all
 			// channels together
-			// [todo] - is the division by 9 right here? Is that the correct
-			// normalisation factor?
-			gradX := math.Sqrt(float64((gx[0] * gx[0]) + (gx[1] * gx[1]) + (gx[2] * gx[2])))
-			gradY := math.Sqrt(float64((gy[0] * gy[0]) + (gy[1] * gy[1]) + (gy[2] * gy[2])))
+			gradX := math.Sqrt((gx[0] * gx[0]) + (gx[1] * gx[1]) + (gx[2] * gx[2]))
+			gradY := math.Sqrt((gy[0] * gy[0]) + (gy[1] * gy[1]) + (gy[2] * gy[2]))
 
 			// gradX := (math.Abs(float64(gx[0])) + math.Abs(float64(gx[1])) +
 			// math.Abs(float64(gx[2]))) / 3
@@ -257,14 +270,14 @@ func RunSeparateColourImageProc() {
 	fmt.Print(" Done\n")
 	fmt.Print("Decoding file to Image...")
 
-	img, _, err := image.Decode(reader)
+	img, _, err := DecodeImage(reader)
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Print(" Done\n")
 
 	fmt.Print("Convert to RBGA format...")
-	rgba := imageToRGBA(img)
+	rgba := imageToRGBA(img, nil)
 	fmt.Print(" Done\n")
 
 	fmt.Print("Applying Gaussian blur...")
@@ -327,7 +340,7 @@ func RunSeparateColourImageProc() {
 }
 
 // [todo] -- add root app CLI options to colour processing
-func RunColourImageProc(filename string, outputFilename string) {
+func RunColourImageProc(filename string, outputFilename string, cs ColourSpace, bg color.Color) {
 	fmt.Print("Reading in file...")
 
 	reader, err := os.Open(filename)
@@ -339,22 +352,22 @@ func RunColourImageProc(filename string, outputFilename string) {
 	fmt.Print(" Done\n")
 	fmt.Print("Decoding file to Image...")
 
-	img, _, err := image.Decode(reader)
+	img, _, err := DecodeImage(reader)
 	if err != nil {
 		log.Fatal(err)
 	}
 	fmt.Print(" Done\n")
 
 	fmt.Print("Convert to RBGA format...")
-	rgba := imageToRGBA(img)
+	rgba := imageToRGBA(img, bg)
 	fmt.Print(" Done\n")
 
 	fmt.Print("Applying Gaussian blur...")
 	blurImg := GaussianBlurColour(rgba, 2.0)
 	fmt.Print(" Done\n")
 
-	fmt.Print("Applying Sobel Filter for each colour...")
-	ig := ColourSobelFilter(blurImg)
+	fmt.Printf("Applying Sobel Filter for each channel of %v colour space...", cs)
+	ig := ColourSpaceSobelFilter(blurImg, cs)
 	fmt.Print(" Done\n")
 
 	fmt.Print("Applying non-max suppression...")
@@ -376,16 +389,9 @@ func RunColourImageProc(filename string, outputFilename string) {
 	fmt.Print(" Done\n")
 
 	fmt.Printf("Saving to output file: \"%v\"", outputFilename)
-	outputFile, err := os.Create(outputFilename)
-	if err != nil {
+	if err := SaveImage(outputFilename, grayImg, ""); err != nil {
 		log.Fatal(err)
 	}
-	defer outputFile.Close()
-
-	var imgOptions jpeg.Options
-	imgOptions.Quality = 100
-
-	jpeg.Encode(outputFile, grayImg, &imgOptions)
 
 	fmt.Print(" Done\n")
 }
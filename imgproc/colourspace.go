@@ -0,0 +1,97 @@
+package cic
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// ColourSpace selects the coordinates in which colours are compared, both for
+// clustering and for colour gradients.
+type ColourSpace int
+
+const (
+	// RGBSpace compares raw sRGB channel values.
+	RGBSpace ColourSpace = iota
+	// LabSpace compares CIELAB coordinates, so that distances follow
+	// perceived colour difference (ΔE).
+	LabSpace
+	// HSVSpace compares positions in the HSV cone, so that hue differences
+	// matter more for saturated, bright colours than for greys.
+	HSVSpace
+)
+
+// labScale stretches CIELAB coordinates so that lightness spans 0-255 like an
+// RGB channel, keeping thresholds tuned for RGB in a similar range.
+const labScale = 2.55
+
+func ParseColourSpace(s string) (ColourSpace, error) {
+	switch s {
+	case "rgb":
+		return RGBSpace, nil
+	case "lab":
+		return LabSpace, nil
+	case "hsv":
+		return HSVSpace, nil
+	default:
+		return RGBSpace, fmt.Errorf("unknown colour space %q (valid options are rgb, lab and hsv)", s)
+	}
+}
+
+func (cs ColourSpace) String() string {
+	switch cs {
+	case LabSpace:
+		return "lab"
+	case HSVSpace:
+		return "hsv"
+	default:
+		return "rgb"
+	}
+}
+
+// Coordinates returns the position of a colour in the colour space, as three
+// values each spanning roughly 0-255, between which Euclidean distance is
+// meaningful.
+func (cs ColourSpace) Coordinates(c color.RGBA) [3]float64 {
+	switch cs {
+	case LabSpace:
+		lab := ConvertRGBA2Lab(c)
+		return [3]float64{lab.L * labScale, lab.A * labScale, lab.B * labScale}
+	case HSVSpace:
+		// Hue is an angle, so place colours on a cone whose radius is the
+		// chroma (S × V) and whose height is the value.
+		if c.A == 0 {
+			return [3]float64{0, 0, 0}
+		}
+		h, s, v, _ := ConvertRGBA2HSVA(c)
+		theta := float64(h) * math.Pi / 180
+		chroma := float64(s) * float64(v) / 255
+		return [3]float64{chroma * math.Cos(theta), chroma * math.Sin(theta), float64(v)}
+	default:
+		return [3]float64{float64(c.R), float64(c.G), float64(c.B)}
+	}
+}
+
+// Colour converts coordinates in the colour space back to the nearest opaque
+// RGBA colour.
+func (cs ColourSpace) Colour(v [3]float64) color.RGBA {
+	switch cs {
+	case LabSpace:
+		return ConvertLab2RGBA(Lab{v[0] / labScale, v[1] / labScale, v[2] / labScale})
+	case HSVSpace:
+		chroma := math.Hypot(v[0], v[1])
+		value := math.Max(0, math.Min(255, v[2]))
+		hue := math.Atan2(v[1], v[0]) * 180 / math.Pi
+		if hue < 0 {
+			hue += 360
+		}
+		var sat float64
+		if value > 0 {
+			sat = math.Min(255, chroma*255/value)
+		}
+		r, g, b, _ := HSVA{uint16(math.Round(hue)) % 360, clampUint8(sat), clampUint8(value), 255}.RGBA()
+		return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
+	default:
+		return color.RGBA{clampUint8(v[0]), clampUint8(v[1]), clampUint8(v[2]), 255}
+	}
+}
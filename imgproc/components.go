@@ -0,0 +1,194 @@
+package cic
+
+import (
+	"image"
+	"sort"
+)
+
+// Offsets of the neighbours of a pixel, with the 4 edge-sharing neighbours
+// first, so that 4-connectivity uses the first 4 and 8-connectivity all 8.
+var neighbourOffsets = [8]image.Point{
+	{1, 0}, {0, 1}, {-1, 0}, {0, -1},
+	{1, 1}, {-1, 1}, {-1, -1}, {1, -1},
+}
+
+// LabelComponents divides a width × height grid of pixels into connected
+// components. Pixels are indexed in raster order, and two neighbouring pixels
+// (4- or 8-connected, according to connectivity) belong to the same component
+// if same reports true for their indices. Pixels for which include reports
+// false are left out of every component, with label -1; a nil include keeps
+// every pixel.
+//
+// LabelComponents returns the component label of each pixel, numbered from 0
+// in the order components are first met, and the size of each component.
+func LabelComponents(
+	width int,
+	height int,
+	connectivity int,
+	include func(idx int) bool,
+	same func(a, b int) bool,
+) ([]int, []int) {
+	labels := make([]int, width*height)
+	for idx := range labels {
+		labels[idx] = -1
+	}
+
+	neighbours := neighbourOffsets[:4]
+	if connectivity == 8 {
+		neighbours = neighbourOffsets[:]
+	}
+
+	var sizes []int
+	var queue []int
+
+	for start := range labels {
+		if labels[start] >= 0 || (include != nil && !include(start)) {
+			continue
+		}
+
+		label := len(sizes)
+		labels[start] = label
+		size := 0
+		queue = append(queue[:0], start)
+
+		for len(queue) > 0 {
+			idx := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			size++
+
+			x, y := idx%width, idx/width
+			for _, off := range neighbours {
+				nx, ny := x+off.X, y+off.Y
+				if nx < 0 || nx >= width || ny < 0 || ny >= height {
+					continue
+				}
+				nIdx := ny*width + nx
+				if labels[nIdx] >= 0 || (include != nil && !include(nIdx)) || !same(idx, nIdx) {
+					continue
+				}
+				labels[nIdx] = label
+				queue = append(queue, nIdx)
+			}
+		}
+
+		sizes = append(sizes, size)
+	}
+
+	return labels, sizes
+}
+
+// RemoveSmallRegions merges every 4-connected region of a single palette
+// colour smaller than minSize pixels into the neighbouring region it shares
+// the longest border with, which removes isolated speckles left by colour
+// quantisation. The image is modified in place and returned.
+func RemoveSmallRegions(img *image.Paletted, minSize int) *image.Paletted {
+	return MergeRegions(img, func(labels []int, sizes []int) []bool {
+		small := make([]bool, len(sizes))
+		for label, size := range sizes {
+			small[label] = size < minSize
+		}
+		return small
+	})
+}
+
+// MergeRegions merges 4-connected regions of a single palette colour into the
+// neighbouring region they share the longest border with. The regions to
+// merge are chosen by merge, which is given the region label of each pixel (in
+// raster order) and the size of each region, and reports for each region
+// whether it should be merged. The image is modified in place and returned.
+func MergeRegions(img *image.Paletted, merge func(labels []int, sizes []int) []bool) *image.Paletted {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	colourAt := func(idx int) uint8 {
+		return img.ColorIndexAt(bounds.Min.X+idx%width, bounds.Min.Y+idx/width)
+	}
+
+	// Each pass merges every chosen region into a neighbour. Merging two
+	// chosen regions together can leave a region which should still be
+	// merged, so repeat until none are left or no more merges are possible.
+	for {
+		labels, sizes := LabelComponents(width, height, 4, nil, func(a, b int) bool {
+			return colourAt(a) == colourAt(b)
+		})
+
+		var small []int
+		for label, m := range merge(labels, sizes) {
+			if m {
+				small = append(small, label)
+			}
+		}
+		if len(small) == 0 || len(sizes) == 1 {
+			return img
+		}
+		// Merge the smallest regions first
+		sort.SliceStable(small, func(i, j int) bool {
+			return sizes[small[i]] < sizes[small[j]]
+		})
+
+		// Pixels of each small region, and the border length shared with each
+		// neighbouring region
+		firstPixel := make([]int, len(sizes))
+		for idx := len(labels) - 1; idx >= 0; idx-- {
+			firstPixel[labels[idx]] = idx
+		}
+
+		members := map[int][]int{}
+		borders := map[int]map[int]int{}
+		for _, label := range small {
+			members[label] = nil
+			borders[label] = map[int]int{}
+		}
+
+		for idx, label := range labels {
+			if _, ok := members[label]; !ok {
+				continue
+			}
+			members[label] = append(members[label], idx)
+
+			x, y := idx%width, idx/width
+			for _, off := range neighbourOffsets[:4] {
+				nx, ny := x+off.X, y+off.Y
+				if nx < 0 || nx >= width || ny < 0 || ny >= height {
+					continue
+				}
+				if nLabel := labels[ny*width+nx]; nLabel != label {
+					borders[label][nLabel]++
+				}
+			}
+		}
+
+		merged := 0
+		for _, label := range small {
+			best, bestBorder := -1, 0
+			for nLabel, border := range borders[label] {
+				// Prefer the longest border, breaking ties by the larger
+				// region and then the lower label, so results don't depend on
+				// map order.
+				if border > bestBorder ||
+					(border == bestBorder && sizes[nLabel] > sizes[best]) ||
+					(border == bestBorder && sizes[nLabel] == sizes[best] && nLabel < best) {
+					best, bestBorder = nLabel, border
+				}
+			}
+			if best < 0 {
+				continue
+			}
+
+			// Take the colour from a pixel of the neighbouring region, which
+			// may itself have been merged earlier in this pass
+			colour := colourAt(firstPixel[best])
+
+			for _, idx := range members[label] {
+				img.SetColorIndex(bounds.Min.X+idx%width, bounds.Min.Y+idx/width, colour)
+				labels[idx] = best
+			}
+			sizes[best] += sizes[label]
+			merged++
+		}
+
+		if merged == 0 {
+			return img
+		}
+	}
+}
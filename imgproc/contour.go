@@ -0,0 +1,182 @@
+package cic
+
+import (
+	"image"
+	"math"
+)
+
+// ContourPoint is a point on a traced line, at the centre of an edge pixel,
+// with the strength of the edge there from 0 to 1.
+type ContourPoint struct {
+	X, Y     float64
+	Strength float64
+}
+
+// Contour is a line traced through an edge map, as an ordered list of points.
+// A closed contour loops back from its last point to its first, which is not
+// repeated.
+type Contour struct {
+	Points []ContourPoint
+	Closed bool
+}
+
+// Length returns the length of the contour, following its points in order.
+func (c Contour) Length() float64 {
+	length := 0.0
+	for i := 1; i < len(c.Points); i++ {
+		length += math.Hypot(c.Points[i].X-c.Points[i-1].X, c.Points[i].Y-c.Points[i-1].Y)
+	}
+	if c.Closed && len(c.Points) > 1 {
+		first, last := c.Points[0], c.Points[len(c.Points)-1]
+		length += math.Hypot(first.X-last.X, first.Y-last.Y)
+	}
+	return length
+}
+
+// skeleton is a one pixel wide edge map, with the neighbours of each pixel
+// found by m-adjacency: diagonal neighbours count only when not also reachable
+// through an edge-sharing neighbour, so that the steps of a staircase line
+// don't look like junctions.
+type skeleton struct {
+	width, height int
+	mask          []bool
+}
+
+func (sk *skeleton) set(x, y int) bool {
+	return x >= 0 && x < sk.width && y >= 0 && y < sk.height && sk.mask[y*sk.width+x]
+}
+
+// neighbours returns the m-adjacent neighbours of the pixel at idx.
+func (sk *skeleton) neighbours(idx int) []int {
+	x, y := idx%sk.width, idx/sk.width
+
+	var ns []int
+	for i, off := range neighbourOffsets {
+		nx, ny := x+off.X, y+off.Y
+		if !sk.set(nx, ny) {
+			continue
+		}
+		if i >= 4 && (sk.set(nx, y) || sk.set(x, ny)) {
+			continue
+		}
+		ns = append(ns, ny*sk.width+nx)
+	}
+	return ns
+}
+
+// maxPinhole is the largest hole in an edge, in pixels, filled before tracing.
+const maxPinhole = 4
+
+// TraceContours traces the edges of edgeImg, which are light on a black
+// background, into lines. Pinholes in edges are filled, and edges thinned to
+// one pixel wide. Each contour runs between line ends and junctions, where
+// three or more lines meet; lines with neither are traced as closed loops, and
+// isolated pixels as single points. Each point's strength is its edge pixel's
+// gray level, scaled to lie between 0 and 1.
+func TraceContours(edgeImg *image.Gray) []Contour {
+	bounds := edgeImg.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	strength := func(idx int) float64 {
+		return float64(edgeImg.GrayAt(bounds.Min.X+idx%width, bounds.Min.Y+idx/width).Y) / 255
+	}
+	pointStrength := func(idx int) float64 {
+		// A filled pinhole has no strength of its own, so takes the
+		// strongest of its neighbours
+		if s := strength(idx); s > 0 {
+			return s
+		}
+		s := 0.0
+		for _, off := range neighbourOffsets {
+			x, y := idx%width+off.X, idx/width+off.Y
+			if x >= 0 && x < width && y >= 0 && y < height {
+				s = max(s, strength(y*width+x))
+			}
+		}
+		return s
+	}
+
+	mask := make([]bool, width*height)
+	for idx := range mask {
+		mask[idx] = strength(idx) > 0
+	}
+	FillHoles(mask, width, height, maxPinhole)
+	sk := skeleton{width, height, ZhangSuenThin(mask, width, height)}
+
+	point := func(idx int) ContourPoint {
+		return ContourPoint{
+			X:        float64(idx%width) + 0.5,
+			Y:        float64(idx/width) + 0.5,
+			Strength: pointStrength(idx),
+		}
+	}
+
+	degree := make([]int, len(mask))
+	for idx, set := range sk.mask {
+		if set {
+			degree[idx] = len(sk.neighbours(idx))
+		}
+	}
+	isNode := func(idx int) bool { return degree[idx] != 2 }
+
+	var contours []Contour
+	visited := make([]bool, len(mask))
+
+	// follow traces from node start through its neighbour first, until it
+	// reaches another node or, for a loop, comes back to start
+	follow := func(start, first int) Contour {
+		c := Contour{Points: []ContourPoint{point(start)}}
+		prev, cur := start, first
+		for {
+			if cur == start {
+				c.Closed = true
+				return c
+			}
+			c.Points = append(c.Points, point(cur))
+			if isNode(cur) {
+				return c
+			}
+			visited[cur] = true
+
+			next := -1
+			for _, n := range sk.neighbours(cur) {
+				if n != prev {
+					next = n
+					break
+				}
+			}
+			prev, cur = cur, next
+		}
+	}
+
+	// Lines starting at ends and junctions
+	for idx, set := range sk.mask {
+		if !set || !isNode(idx) {
+			continue
+		}
+		if degree[idx] == 0 {
+			contours = append(contours, Contour{Points: []ContourPoint{point(idx)}})
+			continue
+		}
+		for _, n := range sk.neighbours(idx) {
+			// Lines through other pixels are traced once, then marked
+			// visited; lines joining two nodes directly are traced from the
+			// first node in raster order
+			if visited[n] || (isNode(n) && n < idx) {
+				continue
+			}
+			contours = append(contours, follow(idx, n))
+		}
+	}
+
+	// Loops, whose pixels are all left unvisited
+	for idx, set := range sk.mask {
+		if !set || isNode(idx) || visited[idx] {
+			continue
+		}
+		visited[idx] = true
+		contours = append(contours, follow(idx, sk.neighbours(idx)[0]))
+	}
+
+	return contours
+}
@@ -0,0 +1,74 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestTraceContours(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 40, 40))
+
+	// A square outline, a T of three lines meeting at (25, 5), and a dot
+	for i := 2; i <= 12; i++ {
+		img.SetGray(i, 2, color.Gray{255})
+		img.SetGray(i, 12, color.Gray{255})
+		img.SetGray(2, i, color.Gray{255})
+		img.SetGray(12, i, color.Gray{255})
+	}
+	for i := 20; i <= 30; i++ {
+		img.SetGray(i, 5, color.Gray{102})
+	}
+	for j := 6; j <= 15; j++ {
+		img.SetGray(25, j, color.Gray{102})
+	}
+	img.SetGray(35, 35, color.Gray{51})
+
+	contours := TraceContours(img)
+
+	var closed, open, dots int
+	for _, c := range contours {
+		switch {
+		case c.Closed:
+			closed++
+			if len(c.Points) != 40 {
+				t.Fatalf("Square outline traced with %v points, expected 40\n", len(c.Points))
+			}
+		case len(c.Points) == 1:
+			dots++
+			if c.Points[0] != (ContourPoint{35.5, 35.5, 0.2}) {
+				t.Fatalf("Dot traced as %v, expected {35.5 35.5 0.2}\n", c.Points[0])
+			}
+		default:
+			open++
+			for _, p := range c.Points {
+				if p.Strength != 0.4 {
+					t.Fatalf("Point of T traced with strength %v, expected 0.4\n", p.Strength)
+				}
+			}
+		}
+	}
+
+	if closed != 1 || open != 3 || dots != 1 {
+		t.Fatalf("Traced %v closed, %v open and %v single point contours, expected 1, 3 and 1\n",
+			closed, open, dots)
+	}
+}
+
+func TestTraceContoursFillsPinholes(t *testing.T) {
+	// A bar 3 pixels thick with a pinhole, which should trace as one line
+	// rather than a loop round the hole
+	img := image.NewGray(image.Rect(0, 0, 30, 10))
+	for j := 3; j <= 5; j++ {
+		for i := 2; i < 28; i++ {
+			img.SetGray(i, j, color.Gray{255})
+		}
+	}
+	img.SetGray(15, 4, color.Gray{0})
+
+	contours := TraceContours(img)
+
+	if len(contours) != 1 || contours[0].Closed {
+		t.Fatalf("Bar with a pinhole traced as %v contours, expected 1 open line\n", len(contours))
+	}
+}
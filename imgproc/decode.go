@@ -0,0 +1,149 @@
+package cic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"io"
+
+	// Register decoders for image.Decode, besides JPEG and PNG
+	_ "image/gif"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+// DecodeImage decodes an image in any registered format, as image.Decode,
+// returning the image with the name of its format. JPEGs are turned upright
+// by their EXIF orientation tag, as cameras store photos taken in portrait
+// or upside down.
+func DecodeImage(r io.Reader) (image.Image, string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, format, err
+	}
+	if format == "jpeg" {
+		img = OrientImage(img, ExifOrientation(data))
+	}
+	return img, format, nil
+}
+
+// ExifOrientation returns the orientation tag of the EXIF metadata in a JPEG
+// file, from 1 to 8, or 1 (upright) if it has none.
+func ExifOrientation(jpegData []byte) int {
+	d := jpegData
+	if len(d) < 2 || d[0] != 0xff || d[1] != 0xd8 {
+		return 1
+	}
+	d = d[2:]
+
+	// Look through the segments before the image data for the APP1 segment
+	// holding the EXIF metadata, as a TIFF file
+	for len(d) >= 4 && d[0] == 0xff {
+		marker := d[1]
+		if marker == 0xda || marker == 0xd9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(d[2:4]))
+		if length < 2 || len(d) < 2+length {
+			break
+		}
+		segment := d[4 : 2+length]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		d = d[2+length:]
+	}
+	return 1
+}
+
+// tiffOrientation returns the orientation tag in the first IFD of TIFF data,
+// or 1 if it has none.
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(t[4:8]))
+	if ifd < 8 || len(t) < ifd+2 {
+		return 1
+	}
+	entries := int(order.Uint16(t[ifd : ifd+2]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + 12*i
+		if len(t) < entry+12 {
+			break
+		}
+		// The orientation is a single SHORT, held in the value field
+		if order.Uint16(t[entry:entry+2]) == 0x0112 {
+			orientation := int(order.Uint16(t[entry+8 : entry+10]))
+			if orientation < 1 || orientation > 8 {
+				return 1
+			}
+			return orientation
+		}
+	}
+	return 1
+}
+
+// OrientImage turns and flips img, stored with the given EXIF orientation,
+// to be upright. Orientations 2 to 8 are, in turn, a mirror image, upside
+// down, upside down and mirrored, and four ways of lying on a side.
+func OrientImage(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+
+	// source returns the point of img shown at (x, y) when upright
+	source := func(x, y int) (int, int) {
+		switch orientation {
+		case 2:
+			return w - 1 - x, y
+		case 3:
+			return w - 1 - x, h - 1 - y
+		case 4:
+			return x, h - 1 - y
+		case 5:
+			return y, x
+		case 6:
+			return y, h - 1 - x
+		case 7:
+			return w - 1 - y, h - 1 - x
+		default:
+			return w - 1 - y, x
+		}
+	}
+
+	// Orientations from 5 lie on their side, so swap width and height
+	outWidth, outHeight := w, h
+	if orientation >= 5 {
+		outWidth, outHeight = h, w
+	}
+
+	out := image.NewRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < outHeight; y++ {
+		for x := 0; x < outWidth; x++ {
+			sx, sy := source(x, y)
+			out.Set(x, y, img.At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package cic
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"golang.org/x/image/bmp"
+)
+
+// exifJPEG encodes img as a JPEG with an EXIF orientation tag.
+func exifJPEG(t *testing.T, img image.Image, orientation uint16) []byte {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}); err != nil {
+		t.Fatalf("Encoding JPEG failed: %v\n", err)
+	}
+
+	// A big-endian TIFF header and one IFD, holding the orientation
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := binary.BigEndian.AppendUint16([]byte{0xff, 0xe1}, uint16(len(segment)+2))
+	app1 = append(app1, segment...)
+
+	data := buf.Bytes()
+	return append(append(append([]byte(nil), data[:2]...), app1...), data[2:]...)
+}
+
+func TestDecodeImageOrientation(t *testing.T) {
+	// A wide image, black on its left half
+	img := image.NewGray(image.Rect(0, 0, 32, 16))
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 32; x++ {
+			if x >= 16 {
+				img.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+
+	data := exifJPEG(t, img, 6)
+	if o := ExifOrientation(data); o != 6 {
+		t.Fatalf("EXIF orientation is %d, expected 6\n", o)
+	}
+
+	// Rotated a quarter turn clockwise, the image is tall and black on top
+	decoded, format, err := DecodeImage(bytes.NewReader(data))
+	if err != nil || format != "jpeg" {
+		t.Fatalf("Decoding JPEG failed: format %q, error %v\n", format, err)
+	}
+	if b := decoded.Bounds(); b.Dx() != 16 || b.Dy() != 32 {
+		t.Fatalf("Rotated image is %v × %v, expected 16 × 32\n", b.Dx(), b.Dy())
+	}
+	top, _, _, _ := decoded.At(8, 4).RGBA()
+	bottom, _, _, _ := decoded.At(8, 28).RGBA()
+	if top>>8 > 32 || bottom>>8 < 224 {
+		t.Fatalf("Rotated image is not black on top and white below\n")
+	}
+
+	if o := ExifOrientation([]byte("not a jpeg")); o != 1 {
+		t.Fatalf("EXIF orientation of non-JPEG is %d, expected 1\n", o)
+	}
+}
+
+func TestOrientImage(t *testing.T) {
+	// A 3 × 2 image with a different value in each pixel:
+	//   0 1 2
+	//   3 4 5
+	img := image.NewGray(image.Rect(0, 0, 3, 2))
+	for i := range img.Pix {
+		img.Pix[i] = uint8(i)
+	}
+
+	for orientation, expected := range map[int][][]uint8{
+		2: {{2, 1, 0}, {5, 4, 3}},
+		3: {{5, 4, 3}, {2, 1, 0}},
+		4: {{3, 4, 5}, {0, 1, 2}},
+		5: {{0, 3}, {1, 4}, {2, 5}},
+		6: {{3, 0}, {4, 1}, {5, 2}},
+		7: {{5, 2}, {4, 1}, {3, 0}},
+		8: {{2, 5}, {1, 4}, {0, 3}},
+	} {
+		out := OrientImage(img, orientation)
+		for y, row := range expected {
+			for x, v := range row {
+				if r, _, _, _ := out.At(x, y).RGBA(); uint8(r>>8) != v {
+					t.Fatalf("Orientation %d has %d at (%d, %d), expected %d\n", orientation, r>>8, x, y, v)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeImageFormats(t *testing.T) {
+	var buf bytes.Buffer
+	if err := bmp.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatalf("Encoding BMP failed: %v\n", err)
+	}
+	if _, format, err := DecodeImage(&buf); err != nil || format != "bmp" {
+		t.Fatalf("Decoding BMP failed: format %q, error %v\n", format, err)
+	}
+}
@@ -0,0 +1,99 @@
+package cic
+
+import "math"
+
+// DistanceTransform returns, for each pixel of a width × height grid indexed in
+// raster order, the Euclidean distance to the nearest pixel for which feature
+// reports true. If there are no feature pixels, every distance is +Inf.
+//
+// This is the exact transform of Felzenszwalb and Huttenlocher, which takes the
+// lower envelope of parabolas along each column and then each row, in time
+// linear in the number of pixels.
+func DistanceTransform(width, height int, feature func(idx int) bool) []float64 {
+	sq := make([]float64, width*height)
+	for idx := range sq {
+		if feature(idx) {
+			sq[idx] = 0
+		} else {
+			sq[idx] = math.Inf(1)
+		}
+	}
+
+	n := max(width, height)
+	f := make([]float64, n)
+	d := make([]float64, n)
+	v := make([]int, n)
+	z := make([]float64, n+1)
+
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			f[y] = sq[y*width+x]
+		}
+		squaredDistance1D(f[:height], d[:height], v, z)
+		for y := 0; y < height; y++ {
+			sq[y*width+x] = d[y]
+		}
+	}
+
+	for y := 0; y < height; y++ {
+		row := sq[y*width : (y+1)*width]
+		copy(f, row)
+		squaredDistance1D(f[:width], d[:width], v, z)
+		copy(row, d[:width])
+	}
+
+	for idx := range sq {
+		sq[idx] = math.Sqrt(sq[idx])
+	}
+	return sq
+}
+
+// squaredDistance1D sets d[q] to the minimum over p of (q-p)² + f[p]. v and z
+// are scratch space, of at least len(f) and len(f)+1 elements.
+func squaredDistance1D(f, d []float64, v []int, z []float64) {
+	n := len(f)
+
+	// Find the first finite sample; parabolas rooted at +Inf never form part
+	// of the lower envelope.
+	first := 0
+	for first < n && math.IsInf(f[first], 1) {
+		first++
+	}
+	if first == n {
+		for q := range d {
+			d[q] = math.Inf(1)
+		}
+		return
+	}
+
+	k := 0
+	v[0] = first
+	z[0] = math.Inf(-1)
+	z[1] = math.Inf(1)
+
+	for q := first + 1; q < n; q++ {
+		if math.IsInf(f[q], 1) {
+			continue
+		}
+		p := v[k]
+		s := ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*(q-p))
+		for s <= z[k] {
+			k--
+			p = v[k]
+			s = ((f[q] + float64(q*q)) - (f[p] + float64(p*p))) / float64(2*(q-p))
+		}
+		k++
+		v[k] = q
+		z[k] = s
+		z[k+1] = math.Inf(1)
+	}
+
+	k = 0
+	for q := 0; q < n; q++ {
+		for z[k+1] < float64(q) {
+			k++
+		}
+		dq := float64(q - v[k])
+		d[q] = dq*dq + f[v[k]]
+	}
+}
@@ -0,0 +1,41 @@
+package cic
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestDistanceTransform(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	width, height := 23, 17
+
+	features := make([]bool, width*height)
+	for idx := range features {
+		features[idx] = rng.Intn(20) == 0
+	}
+
+	dist := DistanceTransform(width, height, func(idx int) bool { return features[idx] })
+
+	for idx := range dist {
+		expected := math.Inf(1)
+		for fIdx, f := range features {
+			if f {
+				expected = min(expected, math.Hypot(
+					float64(idx%width-fIdx%width), float64(idx/width-fIdx/width)))
+			}
+		}
+		if math.Abs(dist[idx]-expected) > 1e-9 {
+			t.Fatalf("Distance of pixel (%v, %v) is %v, expected %v\n",
+				idx%width, idx/width, dist[idx], expected)
+		}
+	}
+}
+
+func TestDistanceTransformNoFeatures(t *testing.T) {
+	for _, d := range DistanceTransform(4, 3, func(int) bool { return false }) {
+		if !math.IsInf(d, 1) {
+			t.Fatalf("Distance with no feature pixels is %v, expected +Inf\n", d)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/bmp"
+	"golang.org/x/image/tiff"
+)
+
+// ImageFormats lists the raster formats images can be written in.
+var ImageFormats = []string{"png", "jpeg", "gif", "bmp", "tiff"}
+
+// formatAliases maps other names and file extensions for formats to their
+// names in ImageFormats.
+var formatAliases = map[string]string{
+	"jpg": "jpeg",
+	"tif": "tiff",
+}
+
+// OutputFormat returns the format to write filename in: format if given, or
+// else the format named by the file's extension, or PNG if it has none. It is
+// an error if the format is not one of formats.
+func OutputFormat(format, filename string, formats []string) (string, error) {
+	source := ""
+	if format == "" {
+		ext := filepath.Ext(filename)
+		if ext == "" {
+			return "png", nil
+		}
+		format = ext[1:]
+		source = fmt.Sprintf(" from the extension of %q", filename)
+	}
+
+	name := strings.ToLower(format)
+	if alias, ok := formatAliases[name]; ok {
+		name = alias
+	}
+	for _, f := range formats {
+		if name == f {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format %q%s (valid options are %v)", format, source, strings.Join(formats, ", "))
+}
+
+// compactImage returns img as a paletted image if it has at most 256
+// colours, so that encoders can write it with fewer bits per pixel: line art
+// in just black and white takes 1 bit per pixel. Otherwise img is returned
+// as it is.
+func compactImage(img image.Image) image.Image {
+	if p, ok := img.(*image.Paletted); ok {
+		return p
+	}
+	bounds := img.Bounds()
+
+	var palette color.Palette
+	index := map[color.Color]uint8{}
+	if gray, ok := img.(*image.Gray); ok {
+		// Gray levels are put in order, darkest first
+		var used [256]bool
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				used[gray.GrayAt(x, y).Y] = true
+			}
+		}
+		for level, u := range used {
+			if u {
+				index[color.Gray{uint8(level)}] = uint8(len(palette))
+				palette = append(palette, color.Gray{uint8(level)})
+			}
+		}
+	} else {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := img.At(x, y)
+				if _, ok := index[c]; ok {
+					continue
+				}
+				if len(palette) == 256 {
+					return img
+				}
+				index[c] = uint8(len(palette))
+				palette = append(palette, c)
+			}
+		}
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			paletted.SetColorIndex(x, y, index[img.At(x, y)])
+		}
+	}
+	return paletted
+}
+
+// binaryAlpha returns img with every pixel made either opaque or fully
+// transparent, as GIF has a single transparent colour and draws all others
+// opaque. Pixels at least half opaque are made opaque.
+func binaryAlpha(img image.Image) image.Image {
+	if !HasAlpha(img) {
+		return img
+	}
+	bounds := img.Bounds()
+	out := image.NewNRGBA(bounds)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			if c.A >= 128 {
+				c.A = 255
+			} else {
+				c = color.NRGBA{}
+			}
+			out.SetNRGBA(x, y, c)
+		}
+	}
+	return out
+}
+
+// EncodeImage writes img to w in format, one of ImageFormats. Lossless
+// formats are written paletted where img has few enough colours, and JPEGs
+// at the highest quality. GIFs can't be partly transparent, so their pixels
+// are made opaque or transparent.
+func EncodeImage(w io.Writer, img image.Image, format string) error {
+	if format == "gif" {
+		img = binaryAlpha(img)
+	}
+	if format != "jpeg" {
+		img = compactImage(img)
+	}
+
+	switch format {
+	case "png":
+		encoder := png.Encoder{CompressionLevel: png.BestCompression}
+		return encoder.Encode(w, img)
+	case "jpeg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 100})
+	case "gif":
+		return gif.Encode(w, img, nil)
+	case "bmp":
+		return bmp.Encode(w, img)
+	case "tiff":
+		return tiff.Encode(w, img, &tiff.Options{Compression: tiff.Deflate})
+	}
+	return fmt.Errorf("unknown image format %q (valid options are %v)", format, strings.Join(ImageFormats, ", "))
+}
+
+// SaveImage writes img to a new file, filename, in format, or in the format
+// named by its extension if format is empty.
+func SaveImage(filename string, img image.Image, format string) error {
+	format, err := OutputFormat(format, filename, ImageFormats)
+	if err != nil {
+		return err
+	}
+
+	outputFile, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer outputFile.Close()
+
+	if err := EncodeImage(outputFile, img, format); err != nil {
+		return err
+	}
+	return outputFile.Close()
+}
@@ -0,0 +1,108 @@
+package cic
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io"
+	"testing"
+)
+
+func TestOutputFormat(t *testing.T) {
+	for _, test := range []struct {
+		format, filename, expected string
+	}{
+		{"", "sheet.png", "png"},
+		{"", "sheet.JPG", "jpeg"},
+		{"", "sheet.tif", "tiff"},
+		{"", "sheet", "png"},
+		{"gif", "sheet.png", "gif"},
+	} {
+		format, err := OutputFormat(test.format, test.filename, ImageFormats)
+		if err != nil || format != test.expected {
+			t.Fatalf("Output format for %q with format %q is %q (error %v), expected %q\n",
+				test.filename, test.format, format, err, test.expected)
+		}
+	}
+
+	if _, err := OutputFormat("", "sheet.svg", ImageFormats); err == nil {
+		t.Fatalf("SVG was accepted as an image format\n")
+	}
+	if _, err := OutputFormat("webp", "sheet.png", ImageFormats); err == nil {
+		t.Fatalf("Unknown format was accepted\n")
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	// Black and white line art is written with 1 bit per pixel
+	img := image.NewGray(image.Rect(0, 0, 16, 16))
+	for i := range img.Pix {
+		img.Pix[i] = 255
+	}
+	for i := 0; i < 16; i++ {
+		img.SetGray(i, i, color.Gray{0})
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, img, "png"); err != nil {
+		t.Fatalf("Encoding PNG failed: %v\n", err)
+	}
+	// The bit depth is the first byte after the width and height in IHDR
+	if depth := buf.Bytes()[24]; depth != 1 {
+		t.Fatalf("Black and white PNG has bit depth %d, expected 1\n", depth)
+	}
+
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decoding PNG failed: %v\n", err)
+	}
+	for y := 0; y < 16; y++ {
+		for x := 0; x < 16; x++ {
+			if r, _, _, _ := decoded.At(x, y).RGBA(); r>>8 != uint32(img.GrayAt(x, y).Y) {
+				t.Fatalf("Decoded PNG differs at (%d, %d)\n", x, y)
+			}
+		}
+	}
+
+	if err := EncodeImage(&buf, img, "webp"); err == nil {
+		t.Fatalf("Encoding in an unknown format succeeded\n")
+	}
+}
+
+func TestEncodeTransparentLineArt(t *testing.T) {
+	// A line fading out across its anti-aliased fringe
+	img := image.NewGray(image.Rect(0, 0, 4, 1))
+	for x, level := range []uint8{0, 100, 200, 255} {
+		img.SetGray(x, 0, color.Gray{level})
+	}
+	sheet := TransparentLineArt(img)
+
+	// PNG keeps the fringe partly transparent, while GIF makes it opaque or
+	// transparent at half opacity
+	tests := []struct {
+		format string
+		decode func(io.Reader) (image.Image, error)
+		alpha  []uint8
+	}{
+		{"png", png.Decode, []uint8{255, 155, 55, 0}},
+		{"gif", gif.Decode, []uint8{255, 255, 0, 0}},
+	}
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := EncodeImage(&buf, sheet, test.format); err != nil {
+			t.Fatalf("Encoding %v failed: %v\n", test.format, err)
+		}
+		decoded, err := test.decode(&buf)
+		if err != nil {
+			t.Fatalf("Decoding %v failed: %v\n", test.format, err)
+		}
+		for x, want := range test.alpha {
+			c := color.NRGBAModel.Convert(decoded.At(x, 0)).(color.NRGBA)
+			if c.A != want || (c.A > 0 && (c.R != 0 || c.G != 0 || c.B != 0)) {
+				t.Errorf("Decoded %v pixel %d is %v, expected black with alpha %d\n", test.format, x, c, want)
+			}
+		}
+	}
+}
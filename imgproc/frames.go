@@ -0,0 +1,367 @@
+package cic
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Frames is a sequence of images, such as the frames of an animation. A
+// directory's frames are loaded one at a time, but a GIF's are all decoded
+// at once, as the image/gif package can only decode them together.
+type Frames interface {
+	Len() int
+	Frame(i int) (image.Image, error)
+}
+
+// gifFrames holds the frames of an animated GIF, each drawn in full.
+type gifFrames []image.Image
+
+func (f gifFrames) Len() int                         { return len(f) }
+func (f gifFrames) Frame(i int) (image.Image, error) { return f[i], nil }
+
+// dirFrames holds the paths of the image files in a directory of frames.
+type dirFrames []string
+
+func (f dirFrames) Len() int { return len(f) }
+
+func (f dirFrames) Frame(i int) (image.Image, error) {
+	reader, err := os.Open(f[i])
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	img, _, err := DecodeImage(reader)
+	return img, err
+}
+
+// OpenFrames opens a sequence of frames: the frames of an animated GIF, or
+// the image files of a directory, in order of their names. Any other image
+// file is a sequence of one frame.
+func OpenFrames(path string) (Frames, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return openFrameDir(path)
+	}
+	if isGIF(path) {
+		return openGIFFrames(path)
+	}
+
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	img, _, err := DecodeImage(reader)
+	if err != nil {
+		return nil, err
+	}
+	return gifFrames{img}, nil
+}
+
+// OpenAnimation opens path as OpenFrames does if it is a sequence of frames:
+// a directory, or a GIF with more than one frame. Otherwise it returns nil,
+// without decoding any image but a GIF, whose frames can't be counted
+// without decoding them.
+func OpenAnimation(path string) (Frames, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return openFrameDir(path)
+	}
+	if !isGIF(path) {
+		return nil, nil
+	}
+
+	frames, err := openGIFFrames(path)
+	if err != nil || frames.Len() < 2 {
+		return nil, err
+	}
+	return frames, nil
+}
+
+func isGIF(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gif")
+}
+
+// openGIFFrames decodes every frame of a GIF file, drawn in full.
+func openGIFFrames(path string) (gifFrames, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	g, err := gif.DecodeAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	return drawGIFFrames(g), nil
+}
+
+// openFrameDir lists the image files of a directory, skipping other files.
+func openFrameDir(dir string) (dirFrames, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var frames dirFrames
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		reader, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		_, _, err = image.DecodeConfig(reader)
+		reader.Close()
+		if errors.Is(err, image.ErrFormat) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", path, err)
+		}
+		frames = append(frames, path)
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no image files in %v", dir)
+	}
+	return frames, nil
+}
+
+// drawGIFFrames draws each frame of an animated GIF in full. A GIF's frames
+// only hold the parts of the picture which change, drawn over what was left
+// by the frame before, as it was disposed of.
+func drawGIFFrames(g *gif.GIF) gifFrames {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	if bounds.Empty() {
+		for _, frame := range g.Image {
+			bounds = bounds.Union(frame.Bounds())
+		}
+	}
+	canvas := image.NewRGBA(bounds)
+
+	clone := func(img *image.RGBA) *image.RGBA {
+		c := image.NewRGBA(img.Bounds())
+		copy(c.Pix, img.Pix)
+		return c
+	}
+
+	var frames gifFrames
+	for i, frame := range g.Image {
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+
+		var previous *image.RGBA
+		if disposal == gif.DisposalPrevious {
+			previous = clone(canvas)
+		}
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+		frames = append(frames, clone(canvas))
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// FrameSelection chooses which frames of a sequence to make sheets of: the
+// frames listed in Indices, or else every Interval-th frame, or else the
+// sharpest frame of each scene, where a scene ends at a change of more than
+// SceneThreshold in the frames' mean brightness, from 0 to 1. MaxFrames
+// limits the number of scenes, keeping the biggest changes.
+type FrameSelection struct {
+	Indices        []int
+	Interval       int
+	SceneThreshold float64
+	MaxFrames      int
+}
+
+// ParseFrameIndices parses a list of frame indices and ranges, counting from
+// 0, such as "0,5,10-12". Frames listed more than once are only returned the
+// first time, so that their sheets aren't made twice.
+func ParseFrameIndices(s string) ([]int, error) {
+	var indices []int
+	seen := make(map[int]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		first, last, isRange := strings.Cut(part, "-")
+		from, err := strconv.Atoi(first)
+		if err != nil || from < 0 {
+			return nil, fmt.Errorf("invalid frame %q in %q", part, s)
+		}
+		to := from
+		if isRange {
+			to, err = strconv.Atoi(last)
+			if err != nil || to < from {
+				return nil, fmt.Errorf("invalid frame range %q in %q", part, s)
+			}
+		}
+		for i := from; i <= to; i++ {
+			if !seen[i] {
+				seen[i] = true
+				indices = append(indices, i)
+			}
+		}
+	}
+	return indices, nil
+}
+
+// sceneGridSize is the number of cells across and down a frame whose mean
+// gray levels are compared to find scene changes.
+const sceneGridSize = 16
+
+// frameSignature returns the mean gray level, from 0 to 1, of each cell of a
+// grid over img. Comparing means rather than pixels ignores noise and small
+// movements.
+func frameSignature(gray *image.Gray) []float64 {
+	bounds := gray.Bounds()
+	sums := make([]float64, sceneGridSize*sceneGridSize)
+	counts := make([]int, len(sums))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cy := (y - bounds.Min.Y) * sceneGridSize / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cx := (x - bounds.Min.X) * sceneGridSize / bounds.Dx()
+			sums[cy*sceneGridSize+cx] += float64(gray.GrayAt(x, y).Y)
+			counts[cy*sceneGridSize+cx]++
+		}
+	}
+	for i := range sums {
+		if counts[i] > 0 {
+			sums[i] /= 255 * float64(counts[i])
+		}
+	}
+	return sums
+}
+
+// Sharpness scores how sharp an image is, as the variance of its Laplacian:
+// blurred frames, caught mid-movement, have weaker edges and score lower.
+func Sharpness(gray *image.Gray) float64 {
+	bounds := gray.Bounds()
+	at := func(x, y int) float64 { return float64(gray.GrayAt(x, y).Y) }
+
+	var sum, sumSq float64
+	n := 0
+	for y := bounds.Min.Y + 1; y < bounds.Max.Y-1; y++ {
+		for x := bounds.Min.X + 1; x < bounds.Max.X-1; x++ {
+			l := at(x-1, y) + at(x+1, y) + at(x, y-1) + at(x, y+1) - 4*at(x, y)
+			sum += l
+			sumSq += l * l
+			n++
+		}
+	}
+	if n == 0 {
+		return 0
+	}
+	mean := sum / float64(n)
+	return sumSq/float64(n) - mean*mean
+}
+
+// SelectFrames returns the indices of the frames chosen by sel, in order.
+func SelectFrames(frames Frames, sel FrameSelection) ([]int, error) {
+	n := frames.Len()
+
+	if len(sel.Indices) > 0 {
+		for _, i := range sel.Indices {
+			if i >= n {
+				return nil, fmt.Errorf("frame %d is out of range (there are %d frames)", i, n)
+			}
+		}
+		return sel.Indices, nil
+	}
+
+	if sel.Interval > 0 {
+		var indices []int
+		for i := 0; i < n; i += sel.Interval {
+			indices = append(indices, i)
+		}
+		return indices, nil
+	}
+
+	// Score every frame, keeping only the scores, so that a directory of
+	// frames is read one frame at a time (a GIF's frames are already all in
+	// memory)
+	type cut struct {
+		frame  int
+		change float64
+	}
+	var cuts []cut
+	sharpness := make([]float64, n)
+	var previous []float64
+	for i := 0; i < n; i++ {
+		img, err := frames.Frame(i)
+		if err != nil {
+			return nil, err
+		}
+		gray := GrayscaleImage(img)
+		sharpness[i] = Sharpness(gray)
+
+		signature := frameSignature(gray)
+		if previous != nil {
+			change := 0.0
+			for j := range signature {
+				change += math.Abs(signature[j] - previous[j])
+			}
+			change /= float64(len(signature))
+			if change > sel.SceneThreshold {
+				cuts = append(cuts, cut{i, change})
+			}
+		}
+		previous = signature
+	}
+
+	if sel.MaxFrames > 0 && len(cuts) >= sel.MaxFrames {
+		sort.Slice(cuts, func(a, b int) bool { return cuts[a].change > cuts[b].change })
+		cuts = cuts[:sel.MaxFrames-1]
+		sort.Slice(cuts, func(a, b int) bool { return cuts[a].frame < cuts[b].frame })
+	}
+
+	// The sharpest frame of each scene
+	starts := []int{0}
+	for _, c := range cuts {
+		starts = append(starts, c.frame)
+	}
+	starts = append(starts, n)
+
+	var indices []int
+	for s := 1; s < len(starts); s++ {
+		best := starts[s-1]
+		for i := best + 1; i < starts[s]; i++ {
+			if sharpness[i] > sharpness[best] {
+				best = i
+			}
+		}
+		indices = append(indices, best)
+	}
+	return indices, nil
+}
+
+// frameFilename returns the name of the output file for frame i of n, by
+// adding the frame's index, padded to the same width for every frame, before
+// the extension of outputFilename.
+func frameFilename(outputFilename string, i, n int) string {
+	ext := filepath.Ext(outputFilename)
+	width := len(strconv.Itoa(n - 1))
+	return fmt.Sprintf("%s-%0*d%s", strings.TrimSuffix(outputFilename, ext), width, i, ext)
+}
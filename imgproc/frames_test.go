@@ -0,0 +1,237 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// solidFrame returns a paletted frame of one colour covering r.
+func solidFrame(r image.Rectangle, c color.Color) *image.Paletted {
+	frame := image.NewPaletted(r, color.Palette{color.Transparent, c})
+	for i := range frame.Pix {
+		frame.Pix[i] = 1
+	}
+	return frame
+}
+
+func TestDrawGIFFrames(t *testing.T) {
+	// A black background, then a white square on it which is cleared, then
+	// a red square drawn over what is left
+	g := &gif.GIF{
+		Image: []*image.Paletted{
+			solidFrame(image.Rect(0, 0, 8, 8), color.Black),
+			solidFrame(image.Rect(2, 2, 4, 4), color.White),
+			solidFrame(image.Rect(4, 4, 6, 6), color.RGBA{255, 0, 0, 255}),
+		},
+		Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+		Config:   image.Config{Width: 8, Height: 8},
+	}
+
+	frames := drawGIFFrames(g)
+	if len(frames) != 3 {
+		t.Fatalf("Got %d frames, expected 3\n", len(frames))
+	}
+
+	tests := []struct {
+		frame int
+		x, y  int
+		want  color.RGBA
+	}{
+		{0, 3, 3, color.RGBA{0, 0, 0, 255}},
+		{1, 3, 3, color.RGBA{255, 255, 255, 255}},
+		{1, 0, 0, color.RGBA{0, 0, 0, 255}},
+		{2, 3, 3, color.RGBA{0, 0, 0, 0}},
+		{2, 5, 5, color.RGBA{255, 0, 0, 255}},
+		{2, 0, 0, color.RGBA{0, 0, 0, 255}},
+	}
+	for _, test := range tests {
+		got := color.RGBAModel.Convert(frames[test.frame].At(test.x, test.y))
+		if got != test.want {
+			t.Errorf("Frame %d at (%d, %d) is %v, expected %v\n",
+				test.frame, test.x, test.y, got, test.want)
+		}
+	}
+}
+
+func TestParseFrameIndices(t *testing.T) {
+	got, err := ParseFrameIndices("0, 5,10-12")
+	if err != nil {
+		t.Fatalf("Parsing failed: %v\n", err)
+	}
+	if want := []int{0, 5, 10, 11, 12}; !slices.Equal(got, want) {
+		t.Errorf("Got %v, expected %v\n", got, want)
+	}
+
+	// Frames listed twice, alone or in overlapping ranges, are kept once
+	dupes := []struct {
+		s    string
+		want []int
+	}{
+		{"1,1", []int{1}},
+		{"3-5,4-6", []int{3, 4, 5, 6}},
+		{"7,2-4,3,7", []int{7, 2, 3, 4}},
+	}
+	for _, test := range dupes {
+		got, err := ParseFrameIndices(test.s)
+		if err != nil {
+			t.Fatalf("Parsing %q failed: %v\n", test.s, err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Parsing %q got %v, expected %v\n", test.s, got, test.want)
+		}
+	}
+
+	for _, s := range []string{"", "a", "-1", "3-1", "1-"} {
+		if _, err := ParseFrameIndices(s); err == nil {
+			t.Errorf("Expected an error parsing %q\n", s)
+		}
+	}
+}
+
+func TestSelectFrames(t *testing.T) {
+	// Two scenes, dark then light, each with one frame of stripes among
+	// flat ones, and those of the second sharper
+	frame := func(level, stripes uint8) image.Image {
+		img := image.NewGray(image.Rect(0, 0, 32, 32))
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				v := level
+				if x%2 == 0 {
+					v += stripes
+				}
+				img.SetGray(x, y, color.Gray{v})
+			}
+		}
+		return img
+	}
+	frames := gifFrames{
+		frame(40, 0), frame(40, 20), frame(40, 0),
+		frame(200, 0), frame(200, 0), frame(200, 40),
+	}
+
+	tests := []struct {
+		sel  FrameSelection
+		want []int
+	}{
+		{FrameSelection{Indices: []int{4, 1}}, []int{4, 1}},
+		{FrameSelection{Interval: 2}, []int{0, 2, 4}},
+		{FrameSelection{SceneThreshold: 0.1}, []int{1, 5}},
+		{FrameSelection{SceneThreshold: 0.1, MaxFrames: 1}, []int{5}},
+	}
+	for _, test := range tests {
+		got, err := SelectFrames(frames, test.sel)
+		if err != nil {
+			t.Fatalf("Selecting frames with %+v failed: %v\n", test.sel, err)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("Selecting frames with %+v got %v, expected %v\n", test.sel, got, test.want)
+		}
+	}
+
+	if _, err := SelectFrames(frames, FrameSelection{Indices: []int{6}}); err == nil {
+		t.Error("Expected an error selecting a frame out of range\n")
+	}
+}
+
+func TestOpenFramesDir(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"frame-2.png", "frame-1.png"} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a frame"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := OpenFrames(dir)
+	if err != nil {
+		t.Fatalf("Opening frames failed: %v\n", err)
+	}
+	want := dirFrames{filepath.Join(dir, "frame-1.png"), filepath.Join(dir, "frame-2.png")}
+	if !slices.Equal(frames.(dirFrames), want) {
+		t.Errorf("Got frames %v, expected %v\n", frames, want)
+	}
+}
+
+func TestOpenAnimation(t *testing.T) {
+	dir := t.TempDir()
+	writeGIF := func(name string, n int) string {
+		path := filepath.Join(dir, name)
+		g := &gif.GIF{Config: image.Config{Width: 4, Height: 4}}
+		for i := 0; i < n; i++ {
+			g.Image = append(g.Image, solidFrame(image.Rect(0, 0, 4, 4), color.Black))
+			g.Delay = append(g.Delay, 0)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err := gif.EncodeAll(f, g); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	still := filepath.Join(dir, "still.png")
+	f, err := os.Create(still)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(f, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{writeGIF("animated.gif", 3), 3},
+		{writeGIF("single.gif", 1), 0},
+		{still, 0},
+		{dir, 3},
+	}
+	for _, test := range tests {
+		frames, err := OpenAnimation(test.path)
+		if err != nil {
+			t.Fatalf("Opening %v failed: %v\n", test.path, err)
+		}
+		got := 0
+		if frames != nil {
+			got = frames.Len()
+		}
+		if got != test.want {
+			t.Errorf("Opening %v got %d frames, expected %d\n", filepath.Base(test.path), got, test.want)
+		}
+	}
+}
+
+func TestFrameFilename(t *testing.T) {
+	tests := []struct {
+		output string
+		i, n   int
+		want   string
+	}{
+		{"edited.png", 3, 120, "edited-003.png"},
+		{"out/sheet.pdf", 12, 13, "out/sheet-12.pdf"},
+		{"sheet", 0, 5, "sheet-0"},
+	}
+	for _, test := range tests {
+		if got := frameFilename(test.output, test.i, test.n); got != test.want {
+			t.Errorf("frameFilename(%q, %d, %d) = %q, expected %q\n",
+				test.output, test.i, test.n, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// isEdge reports whether (x, y) lies inside the gradients and is an edge
+// pixel, i.e. survived threshold suppression.
+func (ig *ImageGradients) isEdge(x, y int) bool {
+	return x >= 0 && x < ig.X && y >= 0 && y < ig.Y && ig.Value[y][x] > 0
+}
+
+// edgeNeighbours returns the 8-connected neighbours of (x, y) which are edge
+// pixels.
+func (ig *ImageGradients) edgeNeighbours(x, y int) []image.Point {
+	var neighbours []image.Point
+	for _, off := range neighbourOffsets {
+		if ig.isEdge(x+off.X, y+off.Y) {
+			neighbours = append(neighbours, image.Point{x + off.X, y + off.Y})
+		}
+	}
+	return neighbours
+}
+
+// isEndpoint reports whether the edge pixel at (x, y) ends a line: it has a
+// single neighbouring edge pixel, or two which touch each other (the corner of
+// a staircase step).
+func (ig *ImageGradients) isEndpoint(x, y int) bool {
+	if !ig.isEdge(x, y) {
+		return false
+	}
+	neighbours := ig.edgeNeighbours(x, y)
+	switch len(neighbours) {
+	case 1:
+		return true
+	case 2:
+		d := neighbours[0].Sub(neighbours[1])
+		return intAbs(d.X) <= 1 && intAbs(d.Y) <= 1
+	default:
+		return false
+	}
+}
+
+// Endpoints returns the ends of every line of edge pixels, in raster order.
+func (ig *ImageGradients) Endpoints() []image.Point {
+	var ends []image.Point
+	for j := 0; j < ig.Y; j++ {
+		for i := 0; i < ig.X; i++ {
+			if ig.isEndpoint(i, j) {
+				ends = append(ends, image.Point{i, j})
+			}
+		}
+	}
+	return ends
+}
+
+// edgeTangent returns a unit step along the edge at (x, y), at right angles to
+// its gradient direction.
+func (ig *ImageGradients) edgeTangent(x, y int) image.Point {
+	switch ig.Direction[y][x] {
+	case zero:
+		return image.Point{0, 1}
+	case fortyfive:
+		return image.Point{1, -1}
+	case ninety:
+		return image.Point{1, 0}
+	default:
+		return image.Point{1, 1}
+	}
+}
+
+// DrawEdgeLine sets the pixels on the straight line from a to b to edge value
+// v, leaving stronger edge pixels as they are.
+func (ig *ImageGradients) DrawEdgeLine(a, b image.Point, v int) {
+	dx, dy := intAbs(b.X-a.X), -intAbs(b.Y-a.Y)
+	sx, sy := 1, 1
+	if a.X > b.X {
+		sx = -1
+	}
+	if a.Y > b.Y {
+		sy = -1
+	}
+
+	// Bresenham's line algorithm
+	err := dx + dy
+	p := a
+	for {
+		if p.X >= 0 && p.X < ig.X && p.Y >= 0 && p.Y < ig.Y && ig.Value[p.Y][p.X] < v {
+			ig.Value[p.Y][p.X] = v
+		}
+		if p == b {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			p.X += sx
+		} else {
+			err += dx
+			p.Y += sy
+		}
+	}
+}
+
+// traceLength is the number of pixels followed back from a line's end to
+// find the direction in which it continues.
+const traceLength = 8
+
+// traceBack follows the line ending at end for up to n pixels, returning the
+// pixels visited, starting with end.
+func (ig *ImageGradients) traceBack(end image.Point, n int) []image.Point {
+	trace := []image.Point{end}
+	visited := map[image.Point]bool{end: true}
+
+	p := end
+	for len(trace) <= n {
+		// Neighbours come edge-sharing first, so the trace prefers them and
+		// doesn't cut corners along a two pixel wide line
+		next, found := image.Point{}, false
+		for _, q := range ig.edgeNeighbours(p.X, p.Y) {
+			if !visited[q] {
+				next, found = q, true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+		trace = append(trace, next)
+		visited[next] = true
+		p = next
+	}
+
+	return trace
+}
+
+// continuation returns the direction in which the line ending at end would
+// continue, as a unit vector, along with the pixels of the line traced to
+// find it. Lines too short to trace take the direction at right angles to the
+// gradient at their end.
+func (ig *ImageGradients) continuation(end image.Point) (float64, float64, []image.Point) {
+	trace := ig.traceBack(end, traceLength)
+
+	var dx, dy float64
+	if len(trace) > 2 {
+		back := trace[len(trace)-1]
+		dx, dy = float64(end.X-back.X), float64(end.Y-back.Y)
+	} else {
+		away := end.Sub(trace[len(trace)-1])
+		step := ig.edgeTangent(end.X, end.Y)
+		switch dot := step.X*away.X + step.Y*away.Y; {
+		case dot < 0:
+			step = step.Mul(-1)
+		case dot == 0:
+			step = away
+		}
+		dx, dy = float64(step.X), float64(step.Y)
+	}
+
+	length := math.Hypot(dx, dy)
+	return dx / length, dy / length, trace
+}
+
+// GapOptions controls how BridgeGaps joins broken edges.
+type GapOptions struct {
+	// MaxGap is the longest gap bridged, in pixels.
+	MaxGap int
+	// MaxAngle is the largest angle, in degrees, between the direction a line
+	// continues in and a bridge from its end.
+	MaxAngle float64
+}
+
+// BridgeGaps joins breaks in edges, so that the shapes they outline are
+// closed. From each line end, it searches a cone, of half-angle opts.MaxAngle
+// about the direction the line continues in, for the closest edge pixel up to
+// opts.MaxGap pixels away, and joins the two with a line as strong as the
+// weaker of its ends. Candidates off the line's axis are penalised in
+// proportion to their angle, so that a line is continued straight where
+// possible.
+//
+// Line ends are only found on lines one pixel wide, so edges should be thinned
+// first; gaps in thicker edges are left open.
+func (ig *ImageGradients) BridgeGaps(opts GapOptions) *ImageGradients {
+	bridged := 0
+	cosMax := math.Cos(opts.MaxAngle * math.Pi / 180)
+
+	for _, end := range ig.Endpoints() {
+		// An earlier bridge may have ended here
+		if !ig.isEndpoint(end.X, end.Y) {
+			continue
+		}
+
+		dx, dy, trace := ig.continuation(end)
+		own := map[image.Point]bool{}
+		for _, p := range trace {
+			own[p] = true
+		}
+
+		best, bestScore := image.Point{}, math.Inf(1)
+		for j := -opts.MaxGap; j <= opts.MaxGap; j++ {
+			for i := -opts.MaxGap; i <= opts.MaxGap; i++ {
+				// Neighbouring pixels would already be joined
+				if intAbs(i) <= 1 && intAbs(j) <= 1 {
+					continue
+				}
+				p := end.Add(image.Point{i, j})
+				if own[p] || !ig.isEdge(p.X, p.Y) {
+					continue
+				}
+
+				dist := math.Hypot(float64(i), float64(j))
+				cos := (float64(i)*dx + float64(j)*dy) / dist
+				if dist > float64(opts.MaxGap) || cos < cosMax {
+					continue
+				}
+
+				angle := math.Acos(min(cos, 1)) * 180 / math.Pi
+				score := dist * (1 + angle/max(opts.MaxAngle, 1))
+				if score < bestScore {
+					best, bestScore = p, score
+				}
+			}
+		}
+
+		if !math.IsInf(bestScore, 1) {
+			v := min(ig.Value[end.Y][end.X], ig.Value[best.Y][best.X])
+			ig.DrawEdgeLine(end, best, v)
+			bridged++
+		}
+	}
+
+	fmt.Printf("\nBridged %v gaps\n", bridged)
+
+	return ig
+}
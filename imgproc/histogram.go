@@ -0,0 +1,166 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+)
+
+// maxHistogramColours is the number of distinct colours above which a colour
+// histogram falls back to quantised bins. Photographs can contain hundreds of
+// thousands of distinct colours, most differing only by noise.
+const maxHistogramColours = 1 << 16
+
+// ColourCount is one entry of a colour histogram: a colour, its coordinates in
+// the histogram's colour space, and the number of pixels it stands for. In a
+// per-pixel histogram, Pos holds the weighted position of the pixel; otherwise
+// it is zero.
+type ColourCount struct {
+	Colour color.RGBA
+	Coords Mean
+	Count  float64
+	Pos    [2]float64
+}
+
+// ColourHistogram summarises the colours of an image, so that algorithms
+// working only on colour (such as k-means) can visit each distinct colour once
+// rather than every pixel.
+//
+// If the image has too many distinct colours, each channel is quantised to 5
+// bits, and each entry holds the average colour of the pixels in its bin.
+//
+// A per-pixel histogram instead has one entry for every pixel, in raster
+// order, so that each entry can also carry the pixel's position.
+type ColourHistogram struct {
+	Space     ColourSpace
+	Colours   []ColourCount
+	Quantised bool
+	PerPixel  bool
+	// Pixels is the total number of pixels counted.
+	Pixels float64
+
+	index  map[uint32]int
+	bounds image.Rectangle
+}
+
+// histogramKey packs a colour into a map key, dropping the low bits of each
+// channel if the histogram is quantised.
+func histogramKey(c color.RGBA, quantised bool) uint32 {
+	if quantised {
+		return uint32(c.R>>3)<<15 | uint32(c.G>>3)<<10 | uint32(c.B>>3)<<5 | uint32(c.A>>3)
+	}
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
+
+func NewColourHistogram(img *image.RGBA, cs ColourSpace) *ColourHistogram {
+	h := buildColourHistogram(img, cs, false)
+	if h == nil {
+		h = buildColourHistogram(img, cs, true)
+	}
+	return h
+}
+
+// buildColourHistogram counts the colours of img. If not quantising and more
+// than maxHistogramColours distinct colours are found, it gives up and returns
+// nil.
+func buildColourHistogram(img *image.RGBA, cs ColourSpace, quantised bool) *ColourHistogram {
+	h := ColourHistogram{Space: cs, Quantised: quantised, index: map[uint32]int{}}
+
+	// Channel sums for each bin, used to average the colours of quantised bins
+	var sums [][4]float64
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			key := histogramKey(c, quantised)
+
+			idx, ok := h.index[key]
+			if !ok {
+				if !quantised && len(h.Colours) == maxHistogramColours {
+					return nil
+				}
+				idx = len(h.Colours)
+				h.index[key] = idx
+				h.Colours = append(h.Colours, ColourCount{Colour: c})
+				sums = append(sums, [4]float64{})
+			}
+
+			h.Colours[idx].Count++
+			sums[idx][0] += float64(c.R)
+			sums[idx][1] += float64(c.G)
+			sums[idx][2] += float64(c.B)
+			sums[idx][3] += float64(c.A)
+		}
+	}
+
+	for idx := range h.Colours {
+		cc := &h.Colours[idx]
+		if quantised {
+			cc.Colour = color.RGBA{
+				clampUint8(sums[idx][0] / cc.Count),
+				clampUint8(sums[idx][1] / cc.Count),
+				clampUint8(sums[idx][2] / cc.Count),
+				clampUint8(sums[idx][3] / cc.Count),
+			}
+		}
+		cc.Coords = Mean(cs.Coordinates(cc.Colour))
+		h.Pixels += cc.Count
+	}
+
+	return &h
+}
+
+// NewPixelHistogram returns a per-pixel histogram of img. Each pixel's position
+// is scaled so that, multiplied by weight 1, crossing the longer side of the
+// image spans the same distance as the full range of a colour channel.
+func NewPixelHistogram(img *image.RGBA, cs ColourSpace, weight float64) *ColourHistogram {
+	bounds := img.Bounds()
+	h := ColourHistogram{
+		Space:    cs,
+		PerPixel: true,
+		Colours:  make([]ColourCount, 0, bounds.Dx()*bounds.Dy()),
+		bounds:   bounds,
+	}
+
+	scale := weight * 255 / float64(max(bounds.Dx(), bounds.Dy()))
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			h.Colours = append(h.Colours, ColourCount{
+				Colour: c,
+				Coords: Mean(cs.Coordinates(c)),
+				Count:  1,
+				Pos: [2]float64{
+					float64(x-bounds.Min.X) * scale,
+					float64(y-bounds.Min.Y) * scale,
+				},
+			})
+		}
+	}
+	h.Pixels = float64(len(h.Colours))
+
+	return &h
+}
+
+// EntryAt returns the index of the histogram entry standing for the pixel at
+// (x, y), whose colour is c, or -1 if it was not counted.
+func (h *ColourHistogram) EntryAt(x, y int, c color.RGBA) int {
+	if h.PerPixel {
+		if !(image.Point{x, y}).In(h.bounds) {
+			return -1
+		}
+		return (y-h.bounds.Min.Y)*h.bounds.Dx() + (x - h.bounds.Min.X)
+	}
+	return h.Lookup(c)
+}
+
+// Lookup returns the index of the histogram entry standing for colour c, or -1
+// if the colour was not counted.
+func (h *ColourHistogram) Lookup(c color.RGBA) int {
+	idx, ok := h.index[histogramKey(c, h.Quantised)]
+	if !ok {
+		return -1
+	}
+	return idx
+}
@@ -0,0 +1,159 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// spectrumImage returns a 256 × 256 image in which every pixel has a different
+// colour, with red varying across and green down.
+func spectrumImage() *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			img.SetRGBA(x, y, color.RGBA{uint8(x), uint8(y), 0, 255})
+		}
+	}
+	return img
+}
+
+func TestColourHistogramExact(t *testing.T) {
+	img := blockImage(5,
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+		color.RGBA{255, 0, 0, 255},
+	)
+	h := NewColourHistogram(img, RGBSpace)
+	if h.Quantised || len(h.Colours) != 2 || h.Pixels != 150 {
+		t.Fatalf("Expected 2 exact colours in 150 pixels, got %v colours in %v pixels (quantised %v)\n",
+			len(h.Colours), h.Pixels, h.Quantised)
+	}
+	if idx := h.Lookup(color.RGBA{255, 0, 0, 255}); idx < 0 || h.Colours[idx].Count != 100 {
+		t.Errorf("Expected red to be counted 100 times, got entry %v\n", idx)
+	}
+
+	// As many distinct colours as allowed are still counted exactly
+	h = NewColourHistogram(spectrumImage(), RGBSpace)
+	if h.Quantised || len(h.Colours) != maxHistogramColours {
+		t.Fatalf("Expected %v exact colours, got %v (quantised %v)\n",
+			maxHistogramColours, len(h.Colours), h.Quantised)
+	}
+	for _, cc := range h.Colours {
+		if cc.Count != 1 {
+			t.Fatalf("Colour %v counted %v times, expected once\n", cc.Colour, cc.Count)
+		}
+	}
+}
+
+func TestColourHistogramQuantised(t *testing.T) {
+	// One more distinct colour than allowed, in an extra row
+	spectrum := spectrumImage()
+	img := image.NewRGBA(image.Rect(0, 0, 256, 257))
+	copy(img.Pix, spectrum.Pix)
+	for x := 0; x < 256; x++ {
+		img.SetRGBA(x, 256, color.RGBA{uint8(x), 0, 1, 255})
+	}
+
+	h := NewColourHistogram(img, RGBSpace)
+	if !h.Quantised {
+		t.Fatal("Expected histogram of too many colours to be quantised\n")
+	}
+	if len(h.Colours) != 32*32 || h.Pixels != 256*257 {
+		t.Fatalf("Expected %v bins of %v pixels, got %v of %v\n", 32*32, 256*257, len(h.Colours), h.Pixels)
+	}
+
+	// The first bin holds red and green from 0 to 7 of the spectrum, and red
+	// from 0 to 7 of the extra row, averaged
+	idx := h.Lookup(color.RGBA{7, 7, 7, 255})
+	if idx < 0 {
+		t.Fatal("Expected a colour in the first bin to be found\n")
+	}
+	want := ColourCount{Colour: color.RGBA{4, 3, 0, 255}, Coords: Mean{4, 3, 0}, Count: 72}
+	if h.Colours[idx] != want {
+		t.Errorf("First bin is %+v, expected %+v\n", h.Colours[idx], want)
+	}
+}
+
+func TestColourHistogramLookup(t *testing.T) {
+	img := blockImage(5, color.RGBA{10, 20, 30, 255}, color.RGBA{200, 100, 0, 255})
+	h := NewColourHistogram(img, RGBSpace)
+
+	for _, c := range []color.RGBA{{10, 20, 30, 255}, {200, 100, 0, 255}} {
+		idx := h.Lookup(c)
+		if idx < 0 || h.Colours[idx].Colour != c {
+			t.Errorf("Looking up %v found entry %v\n", c, idx)
+		}
+		if got := h.EntryAt(0, 0, c); got != idx {
+			t.Errorf("Entry at a pixel of %v is %v, expected %v\n", c, got, idx)
+		}
+	}
+	if idx := h.Lookup(color.RGBA{10, 20, 31, 255}); idx != -1 {
+		t.Errorf("Looking up an uncounted colour found entry %v, expected -1\n", idx)
+	}
+}
+
+func TestPalettedFromHistogram(t *testing.T) {
+	black, gray, white := color.RGBA{0, 0, 0, 255}, color.RGBA{120, 120, 120, 255}, color.RGBA{255, 255, 255, 255}
+	h := NewColourHistogram(blockImage(1, black, gray, white), RGBSpace)
+	palette := color.Palette{black, white}
+	assignments := make([]int, len(h.Colours))
+	assignments[h.Lookup(black)] = 0
+	assignments[h.Lookup(gray)] = 1
+	assignments[h.Lookup(white)] = 1
+
+	// Counted colours take their assigned entry, even where it isn't the
+	// nearest, and an uncounted colour its nearest
+	dark := color.RGBA{30, 30, 30, 255}
+	got := palettedFromHistogram(blockImage(1, black, gray, white, dark), h, palette, assignments)
+	for x, want := range []uint8{0, 1, 1, 0} {
+		if idx := got.ColorIndexAt(x, 0); idx != want {
+			t.Errorf("Pixel %v has palette index %v, expected %v\n", x, idx, want)
+		}
+	}
+}
+
+// noisyImage returns a size × size gradient with noise, so that most of its
+// pixels have distinct colours, as in a photograph.
+func noisyImage(size int) *image.RGBA {
+	rng := rand.New(rand.NewSource(1))
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.SetRGBA(x, y, color.RGBA{
+				uint8(x * 200 / size),
+				uint8(y * 200 / size),
+				uint8(rng.Intn(56)),
+				255,
+			})
+		}
+	}
+	return img
+}
+
+// The k-means benchmarks compare clustering a colour histogram with clustering
+// every pixel, as k-means did before histograms.
+func benchmarkKMeans(b *testing.B, histogram func(*image.RGBA) *ColourHistogram) {
+	img := noisyImage(512)
+	opts := DefaultKMeansOptions(8)
+	opts.Restarts = 1
+	opts.Seed = 1
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		KMeansHistogramClustering(histogram(img), opts)
+	}
+}
+
+func BenchmarkKMeansHistogram(b *testing.B) {
+	benchmarkKMeans(b, func(img *image.RGBA) *ColourHistogram {
+		return NewColourHistogram(img, RGBSpace)
+	})
+}
+
+func BenchmarkKMeansPerPixel(b *testing.B) {
+	benchmarkKMeans(b, func(img *image.RGBA) *ColourHistogram {
+		return NewPixelHistogram(img, RGBSpace, 0)
+	})
+}
@@ -46,7 +46,7 @@ func (c HSVA) RGBA() (r, g, b, a uint32) {
 	var rNorm, gNorm, bNorm float64 = rDash + m, gDash + m, bDash + m
 
 	aFloat := float64(c.A)
-	r, g, b = uint32(rNorm*aFloat), uint32(gNorm*aFloat), uint32(bNorm*aFloat)
+	r, g, b = uint32(math.Round(rNorm*aFloat)), uint32(math.Round(gNorm*aFloat)), uint32(math.Round(bNorm*aFloat))
 
 	return r, g, b, uint32(c.A)
 }
@@ -86,6 +86,7 @@ var colors = map[string]struct {
 func TestHSVA2RGBA(t *testing.T) {
 	t.Parallel()
 	for name, c := range colors {
+		name, c := name, c
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 			r, g, b, a := c.hsva.RGBA()
@@ -100,6 +101,7 @@ func TestHSVA2RGBA(t *testing.T) {
 func TestRGBA2HSVA(t *testing.T) {
 	// t.Parallel()
 	for name, c := range colors {
+		name, c := name, c
 		t.Run(name, func(t *testing.T) {
 			t.Parallel()
 			h, s, v, a := ConvertRGBA2HSVA(c.rgba)
@@ -110,3 +112,12 @@ func TestRGBA2HSVA(t *testing.T) {
 		})
 	}
 }
+
+func TestHSVA2RGBARounding(t *testing.T) {
+	// Green at value 128 and alpha 215 is 128/255 × 215 = 107.92 in
+	// premultiplied green, which rounds to 108 rather than truncating to 107
+	r, g, b, a := HSVA{120, 255, 128, 215}.RGBA()
+	if r != 0 || g != 108 || b != 0 || a != 215 {
+		t.Fatalf("Expected HSVA{120, 255, 128, 215} to convert to {0 108 0 215}, got {%v %v %v %v}\n", r, g, b, a)
+	}
+}
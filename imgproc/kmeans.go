@@ -4,47 +4,85 @@ import (
 	"fmt"
 	"image"
 	"image/color"
-	"image/jpeg"
-	"log"
+	"image/draw"
 	"math"
 	"math/rand"
-	"os"
-
-	_ "image/png"
+	"time"
 )
 
-type Pixel struct {
-	X int
-	Y int
-}
-
-type Mean struct {
-	R uint8
-	G uint8
-	B uint8
+// Mean is the centre of a cluster, given as coordinates in the colour space
+// the clustering is performed in. Coordinates are held as floating point
+// values, so that means can lie between integer colour values and differences
+// between them can be negative.
+type Mean [3]float64
+
+// clampUint8 rounds v to the nearest integer in the range of a uint8.
+func clampUint8(v float64) uint8 {
+	switch {
+	case v <= 0:
+		return 0
+	case v >= 255:
+		return 255
+	default:
+		return uint8(math.Round(v))
+	}
 }
 
+// KMeansClusters holds the state of a k-means clustering of the colours of an
+// image. Clustering works on the image's colour histogram rather than on its
+// pixels, so each distinct colour is only visited once per iteration; the
+// result is mapped back to pixels through the histogram at the end.
 type KMeansClusters struct {
-	K        int
-	Means    []Mean
-	Clusters [][]Pixel
-	CostVal  float64
+	K     int
+	Space ColourSpace
+	Means []Mean
+	// MeanPos gives the weighted position of each mean, when clustering a
+	// per-pixel histogram with spatial features. Otherwise it stays zero.
+	MeanPos   [][2]float64
+	Histogram *ColourHistogram
+	// Assignments gives the cluster of each histogram entry.
+	Assignments []int
+	// Sizes gives the number of pixels in each cluster.
+	Sizes   []float64
+	CostVal float64
+	// Options are used when the clustering is run as a Quantiser.
+	Options KMeansOptions
 }
 
 func InitKMeans(k int) *KMeansClusters {
 	var kmc KMeansClusters
 	kmc.K = k
 	kmc.Means = make([]Mean, k, k)
-	kmc.Clusters = make([][]Pixel, k)
+	kmc.MeanPos = make([][2]float64, k)
+	kmc.Sizes = make([]float64, k)
 	kmc.CostVal = 0.0
 	return &kmc
 }
 
+// SetHistogram sets the colour histogram to be clustered.
+func (kmc *KMeansClusters) SetHistogram(h *ColourHistogram) {
+	kmc.Histogram = h
+	kmc.Space = h.Space
+	kmc.Assignments = make([]int, len(h.Colours))
+}
+
+// MeanOf returns the mean lying exactly at the colour c.
+func (kmc *KMeansClusters) MeanOf(c color.RGBA) Mean {
+	return Mean(kmc.Space.Coordinates(c))
+}
+
+// MeanColour returns the opaque colour nearest to the mean of a cluster.
+func (kmc *KMeansClusters) MeanColour(meanIdx int) color.RGBA {
+	return kmc.Space.Colour(kmc.Means[meanIdx])
+}
+
+func randomColour() color.RGBA {
+	return color.RGBA{uint8(rand.Intn(256)), uint8(rand.Intn(256)), uint8(rand.Intn(256)), 255}
+}
+
 func (kmc *KMeansClusters) RandomiseMeans() {
 	for i := 0; i < kmc.K; i++ {
-		kmc.Means[i].R = uint8(rand.Intn(256))
-		kmc.Means[i].G = uint8(rand.Intn(256))
-		kmc.Means[i].B = uint8(rand.Intn(256))
+		kmc.Means[i] = kmc.MeanOf(randomColour())
 	}
 }
 
@@ -52,173 +90,495 @@ func (kmc *KMeansClusters) PartlyRandomiseMeans() {
 	setMeans := 0
 
 	if kmc.K >= 3 {
-		kmc.Means[0] = Mean{uint8(200 + rand.Intn(56)), 0, 0}
-		kmc.Means[1] = Mean{0, uint8(200 + rand.Intn(56)), 0}
-		kmc.Means[2] = Mean{0, 0, uint8(200 + rand.Intn(56))}
+		kmc.Means[0] = kmc.MeanOf(color.RGBA{uint8(200 + rand.Intn(56)), 0, 0, 255})
+		kmc.Means[1] = kmc.MeanOf(color.RGBA{0, uint8(200 + rand.Intn(56)), 0, 255})
+		kmc.Means[2] = kmc.MeanOf(color.RGBA{0, 0, uint8(200 + rand.Intn(56)), 255})
 
 		setMeans += 3
 	}
 
 	if kmc.K >= 5 {
-		kmc.Means[3] = Mean{0, 0, 0}
-		kmc.Means[4] = Mean{255, 255, 255}
+		kmc.Means[3] = kmc.MeanOf(color.RGBA{0, 0, 0, 255})
+		kmc.Means[4] = kmc.MeanOf(color.RGBA{255, 255, 255, 255})
 
 		setMeans += 2
 	}
 
 	for i := setMeans; i < kmc.K; i++ {
-		kmc.Means[i].R = uint8(rand.Intn(256))
-		kmc.Means[i].G = uint8(rand.Intn(256))
-		kmc.Means[i].B = uint8(rand.Intn(256))
+		kmc.Means[i] = kmc.MeanOf(randomColour())
+	}
+}
+
+// PlusPlusMeans seeds the cluster means using the k-means++ strategy: the first
+// mean is a pixel chosen uniformly at random, and each further mean is a pixel
+// chosen with probability proportional to its squared distance from the
+// nearest mean already chosen. This spreads the initial means across the
+// colours actually present in the image.
+func (kmc *KMeansClusters) PlusPlusMeans(rng *rand.Rand) {
+	colours := kmc.Histogram.Colours
+
+	// Choose a histogram entry with probability proportional to weight
+	choose := func(weight func(idx int) float64, total float64) int {
+		target := rng.Float64() * total
+		for idx := range colours {
+			target -= weight(idx)
+			if target <= 0 {
+				return idx
+			}
+		}
+		return len(colours) - 1
+	}
+
+	first := choose(func(idx int) float64 { return colours[idx].Count }, kmc.Histogram.Pixels)
+	kmc.setMean(0, colours[first])
+
+	// Squared distance from each colour to its nearest chosen mean
+	nearest := make([]float64, len(colours))
+	for idx := range nearest {
+		nearest[idx] = math.MaxFloat64
 	}
+
+	for m := 1; m < kmc.K; m++ {
+		total := 0.0
+		for idx, cc := range colours {
+			dist := kmc.entryDist(cc, m-1)
+			if dist < nearest[idx] {
+				nearest[idx] = dist
+			}
+			total += nearest[idx] * cc.Count
+		}
+
+		// All pixels already coincide with a mean, so any choice will do
+		if total == 0 {
+			other := rng.Intn(m)
+			kmc.Means[m], kmc.MeanPos[m] = kmc.Means[other], kmc.MeanPos[other]
+			continue
+		}
+
+		chosen := choose(func(idx int) float64 { return nearest[idx] * colours[idx].Count }, total)
+		kmc.setMean(m, colours[chosen])
+	}
+}
+
+// sqDist returns the squared Euclidean distance between two points in a colour
+// space.
+func sqDist(a, b Mean) float64 {
+	d0, d1, d2 := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return d0*d0 + d1*d1 + d2*d2
+}
+
+// setMean places a mean exactly at a histogram entry.
+func (kmc *KMeansClusters) setMean(meanIdx int, cc ColourCount) {
+	kmc.Means[meanIdx] = cc.Coords
+	kmc.MeanPos[meanIdx] = cc.Pos
+}
+
+// entryDist returns the squared distance from a histogram entry to a mean,
+// including the distance between their positions when clustering with
+// spatial features.
+func (kmc *KMeansClusters) entryDist(cc ColourCount, meanIdx int) float64 {
+	dx := cc.Pos[0] - kmc.MeanPos[meanIdx][0]
+	dy := cc.Pos[1] - kmc.MeanPos[meanIdx][1]
+	return sqDist(cc.Coords, kmc.Means[meanIdx]) + dx*dx + dy*dy
+}
+
+// SqDistToMean returns the squared Euclidean distance between a pixel value and
+// the mean of a cluster, measured in the clustering colour space.
+func (kmc *KMeansClusters) SqDistToMean(meanIdx int, px color.RGBA) float64 {
+	return sqDist(kmc.MeanOf(px), kmc.Means[meanIdx])
 }
 
 func (kmc *KMeansClusters) DistToMean(meanIdx int, px color.RGBA) float64 {
-	return math.Sqrt(
-		math.Pow(float64(px.R-kmc.Means[meanIdx].R), 2) +
-			math.Pow(float64(px.G-kmc.Means[meanIdx].G), 2) +
-			math.Pow(float64(px.B-kmc.Means[meanIdx].B), 2),
-	)
+	return math.Sqrt(kmc.SqDistToMean(meanIdx, px))
 }
 
-func (kmc *KMeansClusters) AssignClusters(img *image.RGBA) {
+// nearestMean returns the index of the mean closest to a point in the colour
+// space, and the squared distance to it.
+func (kmc *KMeansClusters) nearestMean(coords Mean) (int, float64) {
+	bestMean := -1
+	bestMeanDist := math.MaxFloat64
+
+	for mIdx := 0; mIdx < kmc.K; mIdx++ {
+		dist := sqDist(coords, kmc.Means[mIdx])
+		if dist < bestMeanDist {
+			bestMean = mIdx
+			bestMeanDist = dist
+		}
+	}
+
+	return bestMean, bestMeanDist
+}
+
+// NearestMean returns the index of the mean closest to a pixel value, and the
+// squared distance to it.
+func (kmc *KMeansClusters) NearestMean(px color.RGBA) (int, float64) {
+	return kmc.nearestMean(kmc.MeanOf(px))
+}
+
+// AssignClusters assigns each colour of the histogram to the cluster with the
+// nearest mean, and updates the cluster sizes and cost.
+func (kmc *KMeansClusters) AssignClusters() {
 	for i := 0; i < kmc.K; i++ {
-		kmc.Clusters[i] = []Pixel{}
+		kmc.Sizes[i] = 0
 	}
 	kmc.CostVal = 0.0
 
-	for y := img.Bounds().Min.Y; y < img.Bounds().Max.Y; y++ {
-		for x := img.Bounds().Min.X; x < img.Bounds().Max.X; x++ {
-			bestMean := -1
-			bestMeanDist := math.MaxFloat64
+	for idx, cc := range kmc.Histogram.Colours {
+		bestMean, bestMeanDist := -1, math.MaxFloat64
+		for mIdx := 0; mIdx < kmc.K; mIdx++ {
+			if dist := kmc.entryDist(cc, mIdx); dist < bestMeanDist {
+				bestMean, bestMeanDist = mIdx, dist
+			}
+		}
+
+		kmc.Assignments[idx] = bestMean
+		kmc.Sizes[bestMean] += cc.Count
+		kmc.CostVal += bestMeanDist * cc.Count
+	}
 
-			pxval := img.RGBAAt(x, y)
+	// Normalise cost function by dividing by number of pixels in image
+	kmc.CostVal /= kmc.Histogram.Pixels
+}
 
-			for mIdx := 0; mIdx < kmc.K; mIdx++ {
-				dist := kmc.DistToMean(mIdx, pxval)
-				if dist < bestMeanDist {
-					bestMean = mIdx
-					bestMeanDist = dist
-				}
-			}
+// assignmentCost returns the cost of the current assignment of colours to
+// clusters, normalised by the number of pixels, as AssignClusters computes.
+func (kmc *KMeansClusters) assignmentCost() float64 {
+	cost := 0.0
+	for idx, cc := range kmc.Histogram.Colours {
+		cost += kmc.entryDist(cc, kmc.Assignments[idx]) * cc.Count
+	}
+	return cost / kmc.Histogram.Pixels
+}
+
+// farthestColours returns the indices of up to n histogram entries which lie
+// farthest from the means of the clusters they are currently assigned to, in
+// order of decreasing distance. Colours which already sit exactly on their
+// mean are never returned.
+func (kmc *KMeansClusters) farthestColours(n int) []int {
+	type candidate struct {
+		idx  int
+		dist float64
+	}
+	var best []candidate
 
-			kmc.Clusters[bestMean] = append(kmc.Clusters[bestMean], Pixel{x, y})
-			kmc.CostVal += math.Pow(bestMeanDist, 2)
+	for idx, cc := range kmc.Histogram.Colours {
+		dist := kmc.entryDist(cc, kmc.Assignments[idx])
+		if dist == 0 || (len(best) == n && dist <= best[n-1].dist) {
+			continue
 		}
+
+		// Insert into best, which is kept sorted by decreasing distance
+		pos := len(best)
+		for pos > 0 && best[pos-1].dist < dist {
+			pos--
+		}
+		if len(best) < n {
+			best = append(best, candidate{})
+		}
+		copy(best[pos+1:], best[pos:])
+		best[pos] = candidate{idx, dist}
 	}
 
-	// Normalise cost function by dividing by number of pixels in image
-	pixels := float64((img.Bounds().Max.Y - img.Bounds().Min.Y) * (img.Bounds().Max.X - img.Bounds().Min.X))
+	indices := make([]int, len(best))
+	for i, c := range best {
+		indices[i] = c.idx
+	}
+	return indices
+}
 
-	kmc.CostVal /= pixels
+// CalculateMeans moves each mean to the average value of the pixels in its
+// cluster. A cluster left with no pixels is re-seeded at the colour lying
+// farthest from its own mean, which both avoids dividing by zero and puts the
+// spare mean where it most reduces the cost. CalculateMeans returns the number
+// of clusters re-seeded.
+func (kmc *KMeansClusters) CalculateMeans() int {
+	empty := kmc.centreMeans()
+	if len(empty) == 0 {
+		return 0
+	}
+
+	// If there are fewer distinct far colours than empty clusters, the image
+	// has fewer colours than clusters and the remaining means are left alone.
+	farthest := kmc.farthestColours(len(empty))
+	for i, idx := range farthest {
+		kmc.setMean(empty[i], kmc.Histogram.Colours[idx])
+	}
+
+	return len(farthest)
 }
 
-func (kmc *KMeansClusters) CalculateMeans(img *image.RGBA) {
+// centreMeans moves each mean to the average value of the pixels in its
+// cluster, and returns the clusters with no pixels, whose means are left
+// where they are.
+func (kmc *KMeansClusters) centreMeans() []int {
+	sums := make([]Mean, kmc.K)
+	posSums := make([][2]float64, kmc.K)
+	for idx, cc := range kmc.Histogram.Colours {
+		mIdx := kmc.Assignments[idx]
+		sums[mIdx][0] += cc.Coords[0] * cc.Count
+		sums[mIdx][1] += cc.Coords[1] * cc.Count
+		sums[mIdx][2] += cc.Coords[2] * cc.Count
+		posSums[mIdx][0] += cc.Pos[0] * cc.Count
+		posSums[mIdx][1] += cc.Pos[1] * cc.Count
+	}
+
+	var empty []int
+
 	for i := 0; i < kmc.K; i++ {
-		var runSum = [3]float64{0.0, 0.0, 0.0}
-		norm := float64(len(kmc.Clusters[i]))
-		for _, px := range kmc.Clusters[i] {
-			pxval := img.RGBAAt(px.X, px.Y)
-			runSum[0] += float64(pxval.R)
-			runSum[1] += float64(pxval.G)
-			runSum[2] += float64(pxval.B)
+		if kmc.Sizes[i] == 0 {
+			empty = append(empty, i)
+			continue
 		}
-		kmc.Means[i].R = uint8(runSum[0] / norm)
-		kmc.Means[i].G = uint8(runSum[1] / norm)
-		kmc.Means[i].B = uint8(runSum[2] / norm)
+
+		norm := kmc.Sizes[i]
+		kmc.Means[i] = Mean{sums[i][0] / norm, sums[i][1] / norm, sums[i][2] / norm}
+		kmc.MeanPos[i] = [2]float64{posSums[i][0] / norm, posSums[i][1] / norm}
 	}
+
+	return empty
 }
 
+// AssignClusterMeanValues sets each pixel of the image to the colour of the
+// mean of its cluster, looking the cluster up through the histogram.
 func (kmc *KMeansClusters) AssignClusterMeanValues(img *image.RGBA) *image.RGBA {
-	for meanIdx := 0; meanIdx < kmc.K; meanIdx++ {
-		pxval := color.RGBA{
-			kmc.Means[meanIdx].R,
-			kmc.Means[meanIdx].G,
-			kmc.Means[meanIdx].B,
-			255,
-		}
-		for _, px := range kmc.Clusters[meanIdx] {
-			img.SetRGBA(px.X, px.Y, pxval)
+	meanColours := make([]color.RGBA, kmc.K)
+	for meanIdx := range meanColours {
+		meanColours[meanIdx] = kmc.MeanColour(meanIdx)
+	}
+
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px := img.RGBAAt(x, y)
+
+			var meanIdx int
+			if idx := kmc.Histogram.EntryAt(x, y, px); idx >= 0 {
+				meanIdx = kmc.Assignments[idx]
+			} else {
+				meanIdx, _ = kmc.NearestMean(px)
+			}
+
+			img.SetRGBA(x, y, meanColours[meanIdx])
 		}
 	}
 	return img
 }
 
-func KMeansImage(img *image.RGBA, k int) *image.RGBA {
-	fmt.Printf("Running K-means with %v means", k)
-
-	kmc := InitKMeans(k)
-
-	// Assign initial random cluster means
-	kmc.RandomiseMeans()
+// KMeansOptions holds the parameters controlling a k-means clustering run.
+type KMeansOptions struct {
+	// K is the number of clusters (colours) to find. If K is zero, it is
+	// chosen automatically from the range MinK to MaxK, by ChooseK.
+	K int
+	// MinK and MaxK bound the range searched when choosing K automatically.
+	MinK int
+	MaxK int
+	// KMethod selects how K is chosen automatically: "elbow" or
+	// "silhouette".
+	KMethod string
+	// MaxIterations caps the number of mean update steps in a single run.
+	MaxIterations int
+	// Tolerance is the relative improvement in cost below which a run is
+	// considered to have converged.
+	Tolerance float64
+	// Restarts is the number of independently seeded runs; the run with the
+	// lowest cost is kept.
+	Restarts int
+	// Space is the colour space in which distances between colours are
+	// measured.
+	Space ColourSpace
+	// SpatialWeight, if above zero, adds each pixel's position to the
+	// features clustered, so that distant areas of the same colour can fall
+	// in different clusters. At weight 1, crossing the image counts as much
+	// as the full range of a colour channel. Spatial clustering visits every
+	// pixel rather than every colour, so is much slower.
+	SpatialWeight float64
+	// Seed seeds the random number generator, so that output can be
+	// reproduced. A seed of zero selects a seed from the current time.
+	Seed int64
+}
 
-	// Assign pixels to clusters
-	kmc.AssignClusters(img)
+// DefaultKMeansOptions returns options suitable for clustering a typical image
+// into k colours.
+func DefaultKMeansOptions(k int) KMeansOptions {
+	return KMeansOptions{
+		K:             k,
+		MinK:          2,
+		MaxK:          10,
+		KMethod:       "silhouette",
+		MaxIterations: 50,
+		Tolerance:     1e-4,
+		Restarts:      3,
+	}
+}
 
-	fmt.Printf("Initial (random) setting of means gives cost: %v\n", kmc.CostVal)
+// Fit runs the k-means iteration from the current means, alternately
+// recalculating means and reassigning pixels, until the relative improvement
+// in cost falls below tolerance or maxIterations is reached. The means are
+// then moved to the centres of their final clusters. It returns the number of
+// iterations run.
+func (kmc *KMeansClusters) Fit(maxIterations int, tolerance float64) int {
+	kmc.AssignClusters()
+	fmt.Printf("Initial setting of means gives cost: %v\n", kmc.CostVal)
 
 	lastCostVal := kmc.CostVal
 
-	// Main loop: iterate mean evaluation and cluster reassignment
-	for i := 1; i <= 10; i++ {
-		fmt.Printf("Beginning iteration: %v\nCalculating updated means...", i)
-		kmc.CalculateMeans(img)
-		fmt.Printf(" Done\n")
-		fmt.Printf("Assigning pixels to clusters...")
-		kmc.AssignClusters(img)
-		fmt.Printf(" Done\n")
+	iterations := maxIterations
+	for i := 1; i <= maxIterations; i++ {
+		reseeded := kmc.CalculateMeans()
+		kmc.AssignClusters()
 		fmt.Printf("On iteration %v, cost value is: %v\n", i, kmc.CostVal)
-		fmt.Printf("Cost value improvement of: %v\n\n", kmc.CostVal-lastCostVal)
+
+		// Re-seeding an empty cluster can briefly raise the cost, so only
+		// test for convergence on iterations where no means were moved.
+		improvement := lastCostVal - kmc.CostVal
+		if reseeded == 0 && improvement <= tolerance*lastCostVal {
+			iterations = i
+			break
+		}
 		lastCostVal = kmc.CostVal
 	}
 
-	fmt.Printf("Calculating final mean values for pixel assignment...")
-	kmc.CalculateMeans(img)
-	fmt.Printf(" Done\n")
+	// Recalculate means based on final assignment of pixels to clusters.
+	// Empty clusters aren't re-seeded, as no pixels would be assigned to
+	// them, and the cost is that of the final means.
+	kmc.centreMeans()
+	kmc.CostVal = kmc.assignmentCost()
 
-	// Assign pixels to mean values and return modified image
-	fmt.Printf("Setting pixel values based on cluster mean...")
-	dstImg := kmc.AssignClusterMeanValues(img)
-	fmt.Printf(" Done\n")
+	return iterations
+}
 
-	return dstImg
+// KMeansClustering runs k-means on the image opts.Restarts times, each seeded
+// with k-means++, and returns the clustering with the lowest cost.
+func KMeansClustering(img *image.RGBA, opts KMeansOptions) *KMeansClusters {
+	return KMeansHistogramClustering(kMeansHistogram(img, opts), opts)
 }
 
-func RunKMeansImage(filename string, outputFilename string, k int) {
-	fmt.Print("Reading in file...")
+// kMeansHistogram builds the histogram to cluster: a per-pixel histogram if
+// clustering with spatial features, or a colour histogram otherwise.
+func kMeansHistogram(img *image.RGBA, opts KMeansOptions) *ColourHistogram {
+	if opts.SpatialWeight > 0 {
+		fmt.Printf("Building per-pixel features with spatial weight %v...", opts.SpatialWeight)
+		h := NewPixelHistogram(img, opts.Space, opts.SpatialWeight)
+		fmt.Print(" Done\n")
+		return h
+	}
 
-	reader, err := os.Open(filename)
-	if err != nil {
-		log.Fatal(err)
+	fmt.Print("Building colour histogram...")
+	h := NewColourHistogram(img, opts.Space)
+	fmt.Printf(" Done (%v colours", len(h.Colours))
+	if h.Quantised {
+		fmt.Print(", quantised to 5 bits per channel")
 	}
-	defer reader.Close()
+	fmt.Print(")\n")
 
-	fmt.Print(" Done\n")
-	fmt.Print("Decoding file to Image...")
+	return h
+}
+
+// KMeansHistogramClustering runs k-means on the colours of a histogram
+// opts.Restarts times, and returns the clustering with the lowest cost.
+func KMeansHistogramClustering(h *ColourHistogram, opts KMeansOptions) *KMeansClusters {
+	seed := opts.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	fmt.Printf("Using random seed: %v\n", seed)
+	rng := rand.New(rand.NewSource(seed))
 
-	img, _, err := image.Decode(reader)
-	if err != nil {
-		log.Fatal(err)
+	restarts := opts.Restarts
+	if restarts < 1 {
+		restarts = 1
 	}
-	fmt.Print(" Done\n")
 
-	fmt.Print("Convert to RBGA format...")
-	rgba := imageToRGBA(img)
-	fmt.Print(" Done\n")
+	var best *KMeansClusters
 
-	rgba = KMeansImage(rgba, k)
+	for run := 1; run <= restarts; run++ {
+		fmt.Printf("Beginning run %v of %v\n", run, restarts)
 
-	fmt.Printf("Saving to output file: \"%v\"", outputFilename)
-	outputFile, err := os.Create(outputFilename)
-	if err != nil {
-		log.Fatal(err)
+		kmc := InitKMeans(opts.K)
+		kmc.SetHistogram(h)
+		kmc.PlusPlusMeans(rng)
+		iterations := kmc.Fit(opts.MaxIterations, opts.Tolerance)
+
+		fmt.Printf("Run %v finished after %v iterations with cost: %v\n\n",
+			run, iterations, kmc.CostVal)
+
+		if best == nil || kmc.CostVal < best.CostVal {
+			best = kmc
+		}
+	}
+
+	fmt.Printf("Keeping clustering with lowest cost: %v\n", best.CostVal)
+
+	return best
+}
+
+// kMeansRun clusters the image with the given options, or if opts.K is zero
+// chooses k and keeps the clustering found with it.
+func kMeansRun(img *image.RGBA, opts KMeansOptions) *KMeansClusters {
+	if opts.K == 0 {
+		fmt.Printf("Choosing k between %v and %v\n", opts.MinK, opts.MaxK)
+		kmc, _ := ChooseK(img, opts)
+		return kmc
 	}
-	defer outputFile.Close()
 
-	var imgOptions jpeg.Options
-	imgOptions.Quality = 100
+	fmt.Printf("Running K-means with %v means in %v colour space\n", opts.K, opts.Space)
+
+	return KMeansClustering(img, opts)
+}
+
+func KMeansImage(img *image.RGBA, opts KMeansOptions) *image.RGBA {
+	q := NewKMeansQuantiser(opts)
+
+	// Assign pixels to mean values and return modified image
+	paletted := q.Quantise(img)
+	fmt.Printf("Setting pixel values based on cluster mean...")
+	draw.Draw(img, img.Bounds(), paletted, img.Bounds().Min, draw.Src)
+	fmt.Printf(" Done\n")
 
-	jpeg.Encode(outputFile, rgba, &imgOptions)
+	return img
+}
+
+// NewKMeansQuantiser returns a k-means clustering which, when used as a
+// Quantiser, runs with the given options. An opts.K of zero is kept, so that
+// k is chosen when quantising.
+func NewKMeansQuantiser(opts KMeansOptions) *KMeansClusters {
+	if opts.K != 0 {
+		opts.K = paletteSize(opts.K)
+	}
+	if opts.MaxK > 256 {
+		opts.MaxK = 256
+	}
+	kmc := InitKMeans(opts.K)
+	kmc.Options = opts
+	return kmc
+}
+
+// Quantise clusters the colours of the image with k-means, using the options
+// the clustering was created with, and replaces the clustering's state with
+// the best result found.
+func (kmc *KMeansClusters) Quantise(img *image.RGBA) *image.Paletted {
+	best := kMeansRun(img, kmc.Options)
+	best.Options = kmc.Options
+	*kmc = *best
+
+	return kmc.PalettedImage(img)
+}
+
+// Palette returns the colours of the cluster means.
+func (kmc *KMeansClusters) Palette() color.Palette {
+	palette := make(color.Palette, kmc.K)
+	for meanIdx := range palette {
+		palette[meanIdx] = kmc.MeanColour(meanIdx)
+	}
+	return palette
+}
+
+// PalettedImage draws the image with each pixel set to the mean of its
+// cluster.
+func (kmc *KMeansClusters) PalettedImage(img *image.RGBA) *image.Paletted {
+	return palettedFromHistogram(img, kmc.Histogram, kmc.Palette(), kmc.Assignments)
+}
 
-	fmt.Print(" Done\n")
+func RunKMeansImage(filename string, outputFilename string, opts KMeansOptions) {
+	RunQuantiseImage(filename, outputFilename, NewKMeansQuantiser(opts), 0, nil, nil)
 }
@@ -0,0 +1,219 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"testing"
+)
+
+// blockImage returns an image made of vertical stripes, one per colour, each
+// of the given width and 10 pixels high.
+func blockImage(width int, colours ...color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width*len(colours), 10))
+	for y := 0; y < 10; y++ {
+		for x := 0; x < width*len(colours); x++ {
+			img.SetRGBA(x, y, colours[x/width])
+		}
+	}
+	return img
+}
+
+// sortedColours returns the distinct colours of the means of a clustering,
+// sorted so that results can be compared regardless of cluster order.
+func sortedColours(kmc *KMeansClusters) []color.RGBA {
+	seen := map[color.RGBA]bool{}
+	var colours []color.RGBA
+	for i := range kmc.Means {
+		c := kmc.MeanColour(i)
+		if !seen[c] {
+			seen[c] = true
+			colours = append(colours, c)
+		}
+	}
+	sort.Slice(colours, func(i, j int) bool {
+		a, b := colours[i], colours[j]
+		if a.R != b.R {
+			return a.R < b.R
+		}
+		if a.G != b.G {
+			return a.G < b.G
+		}
+		return a.B < b.B
+	})
+	return colours
+}
+
+var clusterings = map[string]struct {
+	img   *image.RGBA
+	k     int
+	means []color.RGBA
+	cost  float64
+}{
+	"two_colours": {
+		img: blockImage(5,
+			color.RGBA{255, 0, 0, 255},
+			color.RGBA{0, 0, 255, 255},
+		),
+		k: 2,
+		means: []color.RGBA{
+			{0, 0, 255, 255},
+			{255, 0, 0, 255},
+		},
+		cost: 0,
+	},
+	"three_colours": {
+		img: blockImage(4,
+			color.RGBA{10, 200, 30, 255},
+			color.RGBA{250, 250, 250, 255},
+			color.RGBA{0, 0, 0, 255},
+		),
+		k: 3,
+		means: []color.RGBA{
+			{0, 0, 0, 255},
+			{10, 200, 30, 255},
+			{250, 250, 250, 255},
+		},
+		cost: 0,
+	},
+	"merged_pair": {
+		// The two dark stripes are close together and far from white, so
+		// with two clusters they share a mean half way between them.
+		img: blockImage(3,
+			color.RGBA{0, 0, 0, 255},
+			color.RGBA{20, 20, 20, 255},
+			color.RGBA{255, 255, 255, 255},
+		),
+		k: 2,
+		means: []color.RGBA{
+			{10, 10, 10, 255},
+			{255, 255, 255, 255},
+		},
+		cost: 200,
+	},
+	"more_clusters_than_colours": {
+		// Only two colours exist, so spare clusters stay empty without
+		// producing invalid means.
+		img: blockImage(5,
+			color.RGBA{0, 255, 0, 255},
+			color.RGBA{255, 255, 0, 255},
+		),
+		k: 4,
+		means: []color.RGBA{
+			{0, 255, 0, 255},
+			{255, 255, 0, 255},
+		},
+		cost: 0,
+	},
+}
+
+func TestKMeansClustering(t *testing.T) {
+	t.Parallel()
+	for name, c := range clusterings {
+		name, c := name, c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			opts := DefaultKMeansOptions(c.k)
+			opts.Seed = 42
+			kmc := KMeansClustering(c.img, opts)
+
+			means := sortedColours(kmc)
+			if len(means) != len(c.means) {
+				t.Fatalf("Clustering %s found means %v, expected %v\n", name, means, c.means)
+			}
+			for i := range means {
+				if means[i] != c.means[i] {
+					t.Fatalf("Clustering %s found means %v, expected %v\n", name, means, c.means)
+				}
+			}
+
+			for i, m := range kmc.Means {
+				if math.IsNaN(m[0]) || math.IsNaN(m[1]) || math.IsNaN(m[2]) {
+					t.Fatalf("Clustering %s produced invalid mean %v at index %v\n", name, m, i)
+				}
+			}
+
+			if math.Abs(kmc.CostVal-c.cost) > 1e-9 {
+				t.Fatalf("Clustering %s has cost %v, expected %v\n", name, kmc.CostVal, c.cost)
+			}
+		})
+	}
+}
+
+func TestDistToMeanDoesNotWrap(t *testing.T) {
+	kmc := InitKMeans(1)
+	kmc.Means[0] = Mean{255, 255, 255}
+
+	dist := kmc.DistToMean(0, color.RGBA{0, 0, 0, 255})
+	expected := math.Sqrt(3 * 255 * 255)
+	if math.Abs(dist-expected) > 1e-9 {
+		t.Fatalf("Distance from black to white mean was %v, expected %v\n", dist, expected)
+	}
+}
+
+func TestCalculateMeansReseedsEmptyCluster(t *testing.T) {
+	img := blockImage(5,
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{200, 200, 200, 255},
+	)
+
+	kmc := InitKMeans(2)
+	kmc.SetHistogram(NewColourHistogram(img, RGBSpace))
+	kmc.Means[0] = Mean{0, 0, 0}
+	kmc.Means[1] = Mean{0, 0, 255}
+
+	// Force every colour into the first cluster, leaving the second empty
+	for idx := range kmc.Assignments {
+		kmc.Assignments[idx] = 0
+	}
+	kmc.Sizes[0] = kmc.Histogram.Pixels
+
+	reseeded := kmc.CalculateMeans()
+	if reseeded != 1 {
+		t.Fatalf("Expected 1 cluster to be re-seeded, got %v\n", reseeded)
+	}
+	if kmc.Means[1] != (Mean{200, 200, 200}) {
+		t.Fatalf("Empty cluster was re-seeded at %v, expected farthest pixel value %v\n",
+			kmc.Means[1], Mean{200, 200, 200})
+	}
+}
+
+func TestFitEndsOnClusterCentres(t *testing.T) {
+	img := blockImage(5,
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{100, 100, 100, 255},
+		color.RGBA{200, 200, 200, 255},
+	)
+
+	kmc := InitKMeans(2)
+	kmc.SetHistogram(NewColourHistogram(img, RGBSpace))
+	kmc.Means[0] = Mean{40, 40, 40}
+	kmc.Means[1] = Mean{190, 190, 190}
+
+	// Stopping at the iteration limit before any update still leaves each
+	// mean at the centre of the colours assigned to it
+	kmc.Fit(0, 0)
+	for i, want := range []Mean{{50, 50, 50}, {200, 200, 200}} {
+		if kmc.Means[i] != want {
+			t.Fatalf("Mean %v is %v, expected centre of its cluster %v\n", i, kmc.Means[i], want)
+		}
+	}
+
+	// A cluster left empty isn't re-seeded at the end, where no colours would
+	// be assigned to it, and the cost is that of the final means: black and
+	// gray are each 3 × 50² from their mean, in two thirds of the pixels
+	kmc = InitKMeans(3)
+	kmc.SetHistogram(NewColourHistogram(img, RGBSpace))
+	kmc.Means[0] = Mean{40, 40, 40}
+	kmc.Means[1] = Mean{190, 190, 190}
+	kmc.Means[2] = Mean{0, 0, 255}
+	kmc.Fit(0, 0)
+	if kmc.Means[2] != (Mean{0, 0, 255}) {
+		t.Fatalf("Empty cluster's mean moved to %v at the end of fitting\n", kmc.Means[2])
+	}
+	if math.Abs(kmc.CostVal-5000) > 1e-9 {
+		t.Fatalf("Cost after fitting is %v, expected 5000\n", kmc.CostVal)
+	}
+}
@@ -0,0 +1,145 @@
+package cic
+
+import (
+	"image/color"
+	"math"
+)
+
+// Reference white point for conversion between XYZ and CIELAB: standard
+// illuminant D65, which sRGB is defined against.
+const (
+	whiteX = 0.95047
+	whiteY = 1.00000
+	whiteZ = 1.08883
+)
+
+// XYZ is a colour in the CIE 1931 XYZ colour space, with Y (luminance) in the
+// range 0-1.
+type XYZ struct {
+	X, Y, Z float64
+}
+
+// Lab is a colour in the CIELAB colour space. L is lightness, in the range
+// 0-100, and A and B are the green-red and blue-yellow opponent axes. Euclidean
+// distance between two Lab colours (ΔE) approximates the perceived difference
+// between them.
+type Lab struct {
+	L, A, B float64
+}
+
+// srgbLinear holds the linear intensity of each 8-bit sRGB channel value, so
+// that the gamma expansion is only computed once.
+var srgbLinear = func() [256]float64 {
+	var table [256]float64
+	for i := range table {
+		v := float64(i) / 255
+		if v <= 0.04045 {
+			table[i] = v / 12.92
+		} else {
+			table[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	return table
+}()
+
+// srgbCompand converts a linear intensity in the range 0-1 back to a gamma
+// compressed sRGB channel value in the range 0-1.
+func srgbCompand(v float64) float64 {
+	if v <= 0.0031308 {
+		return 12.92 * v
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+func ConvertRGBA2XYZ(c color.RGBA) XYZ {
+	// Scale R, G & B values to alpha un-premultiplied values
+	r, g, b := c.R, c.G, c.B
+	if c.A != 0 && c.A != 255 {
+		r = uint8(math.Min(255, math.Round(float64(c.R)*255/float64(c.A))))
+		g = uint8(math.Min(255, math.Round(float64(c.G)*255/float64(c.A))))
+		b = uint8(math.Min(255, math.Round(float64(c.B)*255/float64(c.A))))
+	}
+
+	rl, gl, bl := srgbLinear[r], srgbLinear[g], srgbLinear[b]
+
+	return XYZ{
+		X: 0.4124564*rl + 0.3575761*gl + 0.1804375*bl,
+		Y: 0.2126729*rl + 0.7151522*gl + 0.0721750*bl,
+		Z: 0.0193339*rl + 0.1191920*gl + 0.9503041*bl,
+	}
+}
+
+func ConvertXYZ2RGBA(c XYZ) color.RGBA {
+	rl := 3.2404542*c.X - 1.5371385*c.Y - 0.4985314*c.Z
+	gl := -0.9692660*c.X + 1.8760108*c.Y + 0.0415560*c.Z
+	bl := 0.0556434*c.X - 0.2040259*c.Y + 1.0572252*c.Z
+
+	return color.RGBA{
+		clampUint8(srgbCompand(rl) * 255),
+		clampUint8(srgbCompand(gl) * 255),
+		clampUint8(srgbCompand(bl) * 255),
+		255,
+	}
+}
+
+// labF is the non-linear compression applied to each XYZ component relative to
+// the white point when converting to CIELAB.
+func labF(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta*delta*delta {
+		return math.Cbrt(t)
+	}
+	return t/(3*delta*delta) + 4.0/29.0
+}
+
+func labFInverse(t float64) float64 {
+	const delta = 6.0 / 29.0
+	if t > delta {
+		return t * t * t
+	}
+	return 3 * delta * delta * (t - 4.0/29.0)
+}
+
+func ConvertXYZ2Lab(c XYZ) Lab {
+	fx := labF(c.X / whiteX)
+	fy := labF(c.Y / whiteY)
+	fz := labF(c.Z / whiteZ)
+
+	return Lab{
+		L: 116*fy - 16,
+		A: 500 * (fx - fy),
+		B: 200 * (fy - fz),
+	}
+}
+
+func ConvertLab2XYZ(c Lab) XYZ {
+	fy := (c.L + 16) / 116
+	fx := fy + c.A/500
+	fz := fy - c.B/200
+
+	return XYZ{
+		X: whiteX * labFInverse(fx),
+		Y: whiteY * labFInverse(fy),
+		Z: whiteZ * labFInverse(fz),
+	}
+}
+
+func ConvertRGBA2Lab(c color.RGBA) Lab {
+	return ConvertXYZ2Lab(ConvertRGBA2XYZ(c))
+}
+
+func ConvertLab2RGBA(c Lab) color.RGBA {
+	return ConvertXYZ2RGBA(ConvertLab2XYZ(c))
+}
+
+// RGBA returns the opaque sRGB colour nearest to the Lab colour, so that Lab
+// satisfies the color.Color interface.
+func (c Lab) RGBA() (r, g, b, a uint32) {
+	return ConvertLab2RGBA(c).RGBA()
+}
+
+// DeltaE returns the CIE76 colour difference between two Lab colours.
+func DeltaE(c1, c2 Lab) float64 {
+	dl, da, db := c1.L-c2.L, c1.A-c2.A, c1.B-c2.B
+	return math.Sqrt(dl*dl + da*da + db*db)
+}
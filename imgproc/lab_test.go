@@ -0,0 +1,94 @@
+package cic
+
+import (
+	"image/color"
+	"math"
+	"testing"
+)
+
+var labColors = map[string]struct {
+	rgba color.RGBA
+	lab  Lab
+}{
+	"black": {
+		rgba: color.RGBA{0, 0, 0, 255},
+		lab:  Lab{0, 0, 0},
+	},
+	"white": {
+		rgba: color.RGBA{255, 255, 255, 255},
+		lab:  Lab{100, 0, 0},
+	},
+	"red": {
+		rgba: color.RGBA{255, 0, 0, 255},
+		lab:  Lab{53.24, 80.09, 67.20},
+	},
+	"lime": {
+		rgba: color.RGBA{0, 255, 0, 255},
+		lab:  Lab{87.73, -86.18, 83.18},
+	},
+	"blue": {
+		rgba: color.RGBA{0, 0, 255, 255},
+		lab:  Lab{32.30, 79.19, -107.86},
+	},
+	"Gray": {
+		rgba: color.RGBA{128, 128, 128, 255},
+		lab:  Lab{53.59, 0, 0},
+	},
+	"olive": {
+		rgba: color.RGBA{128, 128, 0, 255},
+		lab:  Lab{51.87, -12.93, 56.68},
+	},
+	"alpha_normalisation/white": {
+		rgba: color.RGBA{60, 60, 60, 60},
+		lab:  Lab{100, 0, 0},
+	},
+}
+
+func TestRGBA2Lab(t *testing.T) {
+	t.Parallel()
+	for name, c := range labColors {
+		name, c := name, c
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			lab := ConvertRGBA2Lab(c.rgba)
+			if DeltaE(lab, c.lab) > 0.01 {
+				t.Fatalf("Conversion of colour %s from RGBA to Lab failed. Expected %v, got %v\n", name, c.lab, lab)
+			}
+		})
+	}
+}
+
+func TestLab2RGBA(t *testing.T) {
+	t.Parallel()
+	for name, c := range labColors {
+		name, c := name, c
+		if c.rgba.A != 255 {
+			continue
+		}
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			rgba := ConvertLab2RGBA(ConvertRGBA2Lab(c.rgba))
+			if rgba != c.rgba {
+				t.Fatalf("Round trip of colour %s through Lab failed. Expected %v, got %v\n", name, c.rgba, rgba)
+			}
+		})
+	}
+}
+
+func TestColourSpaceRoundTrip(t *testing.T) {
+	t.Parallel()
+	for _, cs := range []ColourSpace{RGBSpace, LabSpace, HSVSpace} {
+		for name, c := range colors {
+			if c.rgba.A != 255 {
+				continue
+			}
+			got := cs.Colour(cs.Coordinates(c.rgba))
+			diff := math.Abs(float64(got.R)-float64(c.rgba.R)) +
+				math.Abs(float64(got.G)-float64(c.rgba.G)) +
+				math.Abs(float64(got.B)-float64(c.rgba.B))
+			if diff > 3 {
+				t.Fatalf("Round trip of colour %s through %v space failed. Expected %v, got %v\n", name, cs, c.rgba, got)
+			}
+		}
+	}
+}
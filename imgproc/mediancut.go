@@ -0,0 +1,130 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"sort"
+)
+
+// MedianCut quantises an image with Heckbert's median cut algorithm. The colour
+// histogram starts as a single box in RGB space; the box with the widest range
+// of any channel is repeatedly split at the pixel-weighted median of that
+// channel, until there are K boxes. Each box's colour is the average of the
+// pixels in it.
+type MedianCut struct {
+	K int
+}
+
+// channelRange returns the channel (0 for R, 1 for G, 2 for B) along which the
+// colours of a box are most spread out, and the size of that spread.
+func channelRange(colours []ColourCount, box []int) (int, int) {
+	lo := [3]uint8{255, 255, 255}
+	hi := [3]uint8{0, 0, 0}
+
+	for _, idx := range box {
+		c := colours[idx].Colour
+		for ch, v := range [3]uint8{c.R, c.G, c.B} {
+			if v < lo[ch] {
+				lo[ch] = v
+			}
+			if v > hi[ch] {
+				hi[ch] = v
+			}
+		}
+	}
+
+	bestCh, bestRange := 0, -1
+	for ch := 0; ch < 3; ch++ {
+		if r := int(hi[ch]) - int(lo[ch]); r > bestRange {
+			bestCh, bestRange = ch, r
+		}
+	}
+	return bestCh, bestRange
+}
+
+func channelValue(c color.RGBA, ch int) uint8 {
+	switch ch {
+	case 0:
+		return c.R
+	case 1:
+		return c.G
+	default:
+		return c.B
+	}
+}
+
+func (mc MedianCut) Quantise(img *image.RGBA) *image.Paletted {
+	h := NewColourHistogram(img, RGBSpace)
+	k := paletteSize(mc.K)
+
+	all := make([]int, len(h.Colours))
+	for idx := range all {
+		all[idx] = idx
+	}
+	boxes := [][]int{all}
+
+	for len(boxes) < k {
+		// Pick the box with the widest channel range
+		split, splitCh, splitRange := -1, 0, 0
+		for b, box := range boxes {
+			if len(box) < 2 {
+				continue
+			}
+			ch, r := channelRange(h.Colours, box)
+			if r > splitRange {
+				split, splitCh, splitRange = b, ch, r
+			}
+		}
+
+		// Every box holds a single colour, so no more splits are possible
+		if split < 0 {
+			break
+		}
+
+		box := boxes[split]
+		sort.SliceStable(box, func(i, j int) bool {
+			return channelValue(h.Colours[box[i]].Colour, splitCh) <
+				channelValue(h.Colours[box[j]].Colour, splitCh)
+		})
+
+		total := 0.0
+		for _, idx := range box {
+			total += h.Colours[idx].Count
+		}
+
+		// Split at the weighted median, keeping at least one colour each side
+		cut := 1
+		acc := h.Colours[box[0]].Count
+		for cut < len(box)-1 && acc < total/2 {
+			acc += h.Colours[box[cut]].Count
+			cut++
+		}
+
+		boxes[split] = box[:cut]
+		boxes = append(boxes, box[cut:])
+	}
+
+	palette := make(color.Palette, len(boxes))
+	assignments := make([]int, len(h.Colours))
+
+	for b, box := range boxes {
+		var sums [3]float64
+		total := 0.0
+		for _, idx := range box {
+			cc := h.Colours[idx]
+			sums[0] += float64(cc.Colour.R) * cc.Count
+			sums[1] += float64(cc.Colour.G) * cc.Count
+			sums[2] += float64(cc.Colour.B) * cc.Count
+			total += cc.Count
+			assignments[idx] = b
+		}
+		palette[b] = color.RGBA{
+			clampUint8(sums[0] / total),
+			clampUint8(sums[1] / total),
+			clampUint8(sums[2] / total),
+			255,
+		}
+	}
+
+	return palettedFromHistogram(img, h, palette, assignments)
+}
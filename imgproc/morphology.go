@@ -0,0 +1,159 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// StructuringElement is the neighbourhood of a morphological operation: the
+// offsets from a pixel of the pixels it is compared with.
+type StructuringElement []image.Point
+
+// SquareElement returns a square of side 2·radius+1.
+func SquareElement(radius int) StructuringElement {
+	var se StructuringElement
+	for j := -radius; j <= radius; j++ {
+		for i := -radius; i <= radius; i++ {
+			se = append(se, image.Point{i, j})
+		}
+	}
+	return se
+}
+
+// DiskElement returns the pixels within radius of the centre.
+func DiskElement(radius int) StructuringElement {
+	var se StructuringElement
+	for j := -radius; j <= radius; j++ {
+		for i := -radius; i <= radius; i++ {
+			if i*i+j*j <= radius*radius {
+				se = append(se, image.Point{i, j})
+			}
+		}
+	}
+	return se
+}
+
+// CrossElement returns a plus sign with arms radius pixels long.
+func CrossElement(radius int) StructuringElement {
+	se := StructuringElement{{0, 0}}
+	for d := 1; d <= radius; d++ {
+		se = append(se, image.Point{d, 0}, image.Point{-d, 0}, image.Point{0, d}, image.Point{0, -d})
+	}
+	return se
+}
+
+// morph sets each pixel to the lowest or highest gray level among the pixels
+// covered by se, ignoring pixels outside the image.
+func morph(img *image.Gray, se StructuringElement, highest bool) *image.Gray {
+	bounds := img.Bounds()
+	dst := image.NewGray(bounds)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			v := img.GrayAt(x, y).Y
+			for _, off := range se {
+				p := image.Point{x + off.X, y + off.Y}
+				if !p.In(bounds) {
+					continue
+				}
+				if c := img.GrayAt(p.X, p.Y).Y; (highest && c > v) || (!highest && c < v) {
+					v = c
+				}
+			}
+			dst.SetGray(x, y, color.Gray{v})
+		}
+	}
+
+	return dst
+}
+
+// Dilate grows the light parts of img: each pixel takes the highest gray level
+// under the structuring element.
+func Dilate(img *image.Gray, se StructuringElement) *image.Gray {
+	return morph(img, se, true)
+}
+
+// Erode shrinks the light parts of img: each pixel takes the lowest gray level
+// under the structuring element.
+func Erode(img *image.Gray, se StructuringElement) *image.Gray {
+	return morph(img, se, false)
+}
+
+// Open erodes then dilates img, removing light specks smaller than the
+// structuring element while leaving larger shapes unchanged.
+func Open(img *image.Gray, se StructuringElement) *image.Gray {
+	return Dilate(Erode(img, se), se)
+}
+
+// Close dilates then erodes img, filling dark gaps and holes smaller than the
+// structuring element while leaving larger shapes unchanged.
+func Close(img *image.Gray, se StructuringElement) *image.Gray {
+	return Erode(Dilate(img, se), se)
+}
+
+// MorphologyOp is a morphological operation with its structuring element, as
+// given on the command line.
+type MorphologyOp struct {
+	Name    string
+	Element StructuringElement
+}
+
+// Apply runs the operation on img.
+func (op MorphologyOp) Apply(img *image.Gray) *image.Gray {
+	switch op.Name {
+	case "dilate":
+		return Dilate(img, op.Element)
+	case "erode":
+		return Erode(img, op.Element)
+	case "open":
+		return Open(img, op.Element)
+	default:
+		return Close(img, op.Element)
+	}
+}
+
+// ParseMorphologyOp parses an operation written as op[:shape[:radius]], such
+// as "close:disk:2". op is dilate, erode, open or close; shape is square, disk
+// (the default) or cross; and radius defaults to 1.
+func ParseMorphologyOp(s string) (MorphologyOp, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return MorphologyOp{}, fmt.Errorf("invalid morphology operation %q (expected op[:shape[:radius]])", s)
+	}
+
+	op := MorphologyOp{Name: parts[0]}
+	switch op.Name {
+	case "dilate", "erode", "open", "close":
+	default:
+		return MorphologyOp{}, fmt.Errorf("unknown morphology operation %q (valid options are dilate, erode, open and close)", op.Name)
+	}
+
+	radius := 1
+	if len(parts) == 3 {
+		r, err := strconv.Atoi(parts[2])
+		if err != nil || r < 0 {
+			return MorphologyOp{}, fmt.Errorf("invalid structuring element radius %q", parts[2])
+		}
+		radius = r
+	}
+
+	shape := "disk"
+	if len(parts) >= 2 {
+		shape = parts[1]
+	}
+	switch shape {
+	case "square":
+		op.Element = SquareElement(radius)
+	case "disk":
+		op.Element = DiskElement(radius)
+	case "cross":
+		op.Element = CrossElement(radius)
+	default:
+		return MorphologyOp{}, fmt.Errorf("unknown structuring element %q (valid options are square, disk and cross)", shape)
+	}
+
+	return op, nil
+}
@@ -0,0 +1,70 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestThin(t *testing.T) {
+	// A bar 5 pixels thick should thin to a single line along its middle
+	ig := CreateImageGradients(30, 11)
+	for j := 3; j < 8; j++ {
+		for i := 2; i < 28; i++ {
+			ig.Value[j][i] = 100
+		}
+	}
+
+	ig.Thin()
+
+	for i := 6; i < 24; i++ {
+		count := 0
+		for j := 0; j < ig.Y; j++ {
+			if ig.Value[j][i] > 0 {
+				count++
+			}
+		}
+		if count != 1 || ig.Value[5][i] != 100 {
+			t.Fatalf("Column %v of thinned bar has %v edge pixels, expected 1 at its middle\n", i, count)
+		}
+	}
+}
+
+func TestMorphology(t *testing.T) {
+	// A light horizontal line with a one pixel break, and a light speck
+	img := image.NewGray(image.Rect(0, 0, 20, 10))
+	for x := 2; x < 18; x++ {
+		if x != 9 {
+			img.SetGray(x, 3, color.Gray{255})
+		}
+	}
+	img.SetGray(10, 7, color.Gray{255})
+
+	closed := Close(img, SquareElement(1))
+	if closed.GrayAt(9, 3).Y != 255 {
+		t.Fatalf("Closing did not fill the break in the line\n")
+	}
+
+	opened := Open(img, CrossElement(1))
+	if opened.GrayAt(10, 7).Y != 0 {
+		t.Fatalf("Opening did not remove the speck\n")
+	}
+
+	dilated := Dilate(img, DiskElement(1))
+	if dilated.GrayAt(10, 6).Y != 255 || dilated.GrayAt(11, 6).Y != 0 {
+		t.Fatalf("Dilating with a disk did not grow the speck into a plus sign\n")
+	}
+}
+
+func TestParseMorphologyOp(t *testing.T) {
+	op, err := ParseMorphologyOp("close:square:2")
+	if err != nil || op.Name != "close" || len(op.Element) != 25 {
+		t.Fatalf("Parsing close:square:2 gave %v (error %v), expected a 5 × 5 square close\n", op, err)
+	}
+
+	for _, s := range []string{"blur", "open:star", "open:disk:-1", "open:disk:1:2"} {
+		if _, err := ParseMorphologyOp(s); err == nil {
+			t.Fatalf("Parsing invalid morphology operation %q succeeded, expected an error\n", s)
+		}
+	}
+}
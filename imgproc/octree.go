@@ -0,0 +1,162 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+)
+
+// octreeDepth is the number of levels below the root of the octree, one for
+// each bit of a colour channel.
+const octreeDepth = 8
+
+// Octree quantises an image by inserting every colour into an octree, in which
+// each level splits the RGB cube in half along all three channels, and then
+// merging the least populated leaves at the deepest level into their parents
+// until no more than K leaves remain. Each leaf's colour is the average of the
+// pixels in it.
+type Octree struct {
+	K int
+}
+
+type octreeNode struct {
+	children [8]*octreeNode
+	leaf     bool
+	// count is the number of pixels in the node's subtree, and sums are the
+	// channel sums of those pixels, which are only kept up to date for leaves.
+	count      float64
+	sums       [3]float64
+	paletteIdx int
+}
+
+// octreeChild returns which child of a node at the given level a colour falls
+// into, from one bit of each channel.
+func octreeChild(c color.RGBA, level int) int {
+	shift := uint(7 - level)
+	return int((c.R>>shift)&1)<<2 | int((c.G>>shift)&1)<<1 | int((c.B>>shift)&1)
+}
+
+type octree struct {
+	root   *octreeNode
+	leaves int
+	// reducible holds, for each level, the nodes with children in the order
+	// they were created.
+	reducible [octreeDepth][]*octreeNode
+}
+
+func (t *octree) insert(c color.RGBA, count float64) {
+	node := t.root
+	for level := 0; level < octreeDepth; level++ {
+		node.count += count
+
+		child := octreeChild(c, level)
+		if node.children[child] == nil {
+			if !node.hasChildren() {
+				t.reducible[level] = append(t.reducible[level], node)
+			}
+			node.children[child] = &octreeNode{leaf: level == octreeDepth-1}
+			if level == octreeDepth-1 {
+				t.leaves++
+			}
+		}
+		node = node.children[child]
+	}
+
+	node.count += count
+	node.sums[0] += float64(c.R) * count
+	node.sums[1] += float64(c.G) * count
+	node.sums[2] += float64(c.B) * count
+}
+
+func (n *octreeNode) hasChildren() bool {
+	for _, child := range n.children {
+		if child != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// reduce merges the children of the least populated node at the deepest level
+// which has children, making that node a leaf.
+func (t *octree) reduce() {
+	level := octreeDepth - 1
+	for level > 0 && len(t.reducible[level]) == 0 {
+		level--
+	}
+
+	nodes := t.reducible[level]
+	smallest := 0
+	for i, n := range nodes {
+		if n.count < nodes[smallest].count {
+			smallest = i
+		}
+	}
+	node := nodes[smallest]
+	t.reducible[level] = append(nodes[:smallest], nodes[smallest+1:]...)
+
+	merged := 0
+	for i, child := range node.children {
+		if child == nil {
+			continue
+		}
+		node.sums[0] += child.sums[0]
+		node.sums[1] += child.sums[1]
+		node.sums[2] += child.sums[2]
+		node.children[i] = nil
+		merged++
+	}
+	node.leaf = true
+	t.leaves -= merged - 1
+}
+
+// assignPalette numbers the leaves of the tree in depth first order and appends
+// their colours to the palette.
+func (n *octreeNode) assignPalette(palette color.Palette) color.Palette {
+	if n.leaf {
+		n.paletteIdx = len(palette)
+		return append(palette, color.RGBA{
+			clampUint8(n.sums[0] / n.count),
+			clampUint8(n.sums[1] / n.count),
+			clampUint8(n.sums[2] / n.count),
+			255,
+		})
+	}
+	for _, child := range n.children {
+		if child != nil {
+			palette = child.assignPalette(palette)
+		}
+	}
+	return palette
+}
+
+// lookup returns the palette index of the leaf a colour falls into.
+func (t *octree) lookup(c color.RGBA) int {
+	node := t.root
+	for level := 0; !node.leaf; level++ {
+		node = node.children[octreeChild(c, level)]
+	}
+	return node.paletteIdx
+}
+
+func (o Octree) Quantise(img *image.RGBA) *image.Paletted {
+	h := NewColourHistogram(img, RGBSpace)
+	k := paletteSize(o.K)
+
+	t := octree{root: &octreeNode{}}
+	for _, cc := range h.Colours {
+		t.insert(cc.Colour, cc.Count)
+	}
+
+	for t.leaves > k {
+		t.reduce()
+	}
+
+	palette := t.root.assignPalette(nil)
+
+	assignments := make([]int, len(h.Colours))
+	for idx, cc := range h.Colours {
+		assignments[idx] = t.lookup(cc.Colour)
+	}
+
+	return palettedFromHistogram(img, h, palette, assignments)
+}
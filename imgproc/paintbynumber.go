@@ -0,0 +1,279 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// PaintByNumberOptions controls how a paint-by-number sheet is drawn.
+type PaintByNumberOptions struct {
+	// MinRegionSize is the smallest region, in pixels, kept as its own area;
+	// smaller regions are merged into a neighbour.
+	MinRegionSize int
+	// MinLabelSize and MaxLabelSize bound the font size of region numbers, in
+	// pixels. Regions too narrow to hold a number at MinLabelSize are merged
+	// into a neighbour.
+	MinLabelSize int
+	MaxLabelSize int
+	// Names gives the name of each palette colour for the legend. Nil names
+	// colours by number only.
+	Names []string
+	// Background is the colour transparent parts of the image are composited
+	// onto before quantising. Nil composites onto white.
+	Background color.Color
+}
+
+func DefaultPaintByNumberOptions() PaintByNumberOptions {
+	return PaintByNumberOptions{
+		MinRegionSize: 64,
+		MinLabelSize:  8,
+		MaxLabelSize:  32,
+	}
+}
+
+// NumberedRegion is one closed area of a paint-by-number sheet: the palette
+// colour it is to be painted, and where its number goes. Pole is the pixel
+// farthest from the region's boundary (its pole of inaccessibility), and Radius
+// that distance.
+type NumberedRegion struct {
+	Colour int
+	Size   int
+	Pole   image.Point
+	Radius float64
+}
+
+// regionPoles finds the pole of inaccessibility of each labelled region of a
+// width × height grid. Pixels bordering another region, or the edge of the
+// grid, are at distance 0.
+func regionPoles(width, height int, labels []int, regions int) ([]image.Point, []float64) {
+	dist := DistanceTransform(width, height, func(idx int) bool {
+		x, y := idx%width, idx/width
+		if x == 0 || y == 0 || x == width-1 || y == height-1 {
+			return true
+		}
+		for _, off := range neighbourOffsets[:4] {
+			if labels[(y+off.Y)*width+x+off.X] != labels[idx] {
+				return true
+			}
+		}
+		return false
+	})
+
+	poles := make([]image.Point, regions)
+	radii := make([]float64, regions)
+	for idx := range radii {
+		radii[idx] = -1
+	}
+	for idx, label := range labels {
+		if dist[idx] > radii[label] {
+			radii[label] = dist[idx]
+			poles[label] = image.Point{idx % width, idx / width}
+		}
+	}
+
+	return poles, radii
+}
+
+// labelRadius is the radius of the smallest circle which holds the number of
+// palette colour i at size pixels, with a pixel to spare.
+func labelRadius(i int, size int) float64 {
+	w, h := textExtent(strconv.Itoa(i+1), size)
+	return math.Hypot(w, h)/2 + 1
+}
+
+// NumberRegions merges regions of img which are too small or too narrow to
+// hold their number, then returns the remaining regions. img is modified in
+// place.
+func NumberRegions(img *image.Paletted, opts PaintByNumberOptions) []NumberedRegion {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	colourAt := func(idx int) int {
+		return int(img.ColorIndexAt(bounds.Min.X+idx%width, bounds.Min.Y+idx/width))
+	}
+
+	minRadius := make([]float64, len(img.Palette))
+	for i := range minRadius {
+		minRadius[i] = labelRadius(i, opts.MinLabelSize)
+	}
+
+	MergeRegions(img, func(labels []int, sizes []int) []bool {
+		_, radii := regionPoles(width, height, labels, len(sizes))
+
+		firstPixel := make([]int, len(sizes))
+		for idx := len(labels) - 1; idx >= 0; idx-- {
+			firstPixel[labels[idx]] = idx
+		}
+
+		merge := make([]bool, len(sizes))
+		for label, size := range sizes {
+			merge[label] = size < opts.MinRegionSize ||
+				radii[label] < minRadius[colourAt(firstPixel[label])]
+		}
+		return merge
+	})
+
+	labels, sizes := LabelComponents(width, height, 4, nil, func(a, b int) bool {
+		return colourAt(a) == colourAt(b)
+	})
+	poles, radii := regionPoles(width, height, labels, len(sizes))
+
+	regions := make([]NumberedRegion, len(sizes))
+	for label := range regions {
+		regions[label] = NumberedRegion{
+			Colour: colourAt(poles[label].Y*width + poles[label].X),
+			Size:   sizes[label],
+			Pole:   poles[label].Add(bounds.Min),
+			Radius: radii[label],
+		}
+	}
+	return regions
+}
+
+// Sizes of the parts of a paint-by-number legend, in pixels
+const (
+	legendSwatch   = 32
+	legendTextSize = 16
+	legendPadding  = 12
+)
+
+// PaintByNumber draws a paint-by-number sheet of a quantised image: the
+// outlines of its regions in black on white, each region numbered with its
+// palette colour, above a legend of numbered colour swatches. Regions too
+// small to hold a number are first merged into their neighbours, modifying img
+// in place.
+func PaintByNumber(img *image.Paletted, opts PaintByNumberOptions) *image.RGBA {
+	regions := NumberRegions(img, opts)
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Lay out the legend with one entry for each colour in use, in as many
+	// columns as fit across the sheet
+	var used []int
+	inUse := make([]bool, len(img.Palette))
+	for _, r := range regions {
+		inUse[r.Colour] = true
+	}
+	for i, u := range inUse {
+		if u {
+			used = append(used, i)
+		}
+	}
+
+	legendLabel := func(i int) string {
+		if i < len(opts.Names) && opts.Names[i] != "" {
+			return fmt.Sprintf("%d  %s", i+1, opts.Names[i])
+		}
+		return strconv.Itoa(i + 1)
+	}
+	entryWidth := 0.0
+	for _, i := range used {
+		w, _ := textExtent(legendLabel(i), legendTextSize)
+		entryWidth = max(entryWidth, w)
+	}
+	entry := image.Pt(legendSwatch+legendPadding+int(math.Ceil(entryWidth))+2*legendPadding, legendSwatch+legendPadding)
+	columns := max(1, (width-legendPadding)/entry.X)
+	rows := (len(used) + columns - 1) / columns
+
+	sheet := image.NewRGBA(image.Rect(0, 0, width, height+legendPadding+rows*entry.Y))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// Region outlines, with a frame around the edge so every region is closed
+	black := color.RGBA{0, 0, 0, 255}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := img.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y)
+			if x == 0 || y == 0 || x == width-1 || y == height-1 ||
+				img.ColorIndexAt(bounds.Min.X+x+1, bounds.Min.Y+y) != c ||
+				img.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y+1) != c {
+				sheet.SetRGBA(x, y, black)
+			}
+		}
+	}
+
+	// Numbers in grey, so they read as labels rather than lines
+	grey := color.RGBA{96, 96, 96, 255}
+	for _, r := range regions {
+		text := strconv.Itoa(r.Colour + 1)
+		size := FitTextSize(text, r.Radius-1, opts.MinLabelSize, opts.MaxLabelSize)
+		DrawText(sheet, text, r.Pole.Sub(bounds.Min), size, grey)
+	}
+
+	for n, i := range used {
+		origin := image.Pt(legendPadding+(n%columns)*entry.X, height+legendPadding+(n/columns)*entry.Y)
+		square := image.Rect(0, 0, legendSwatch, legendSwatch).Add(origin)
+		draw.Draw(sheet, square, image.Black, image.Point{}, draw.Src)
+		draw.Draw(sheet, square.Inset(1), image.NewUniform(img.Palette[i]), image.Point{}, draw.Src)
+
+		text := legendLabel(i)
+		w, _ := textExtent(text, legendTextSize)
+		centre := image.Pt(square.Max.X+legendPadding+int(w/2), origin.Y+legendSwatch/2)
+		DrawText(sheet, text, centre, legendTextSize, black)
+	}
+
+	return sheet
+}
+
+// RunPaintByNumber makes a paint-by-number sheet from an image file. The image
+// is blurred by a Gaussian of standard deviation sigma, to smooth away detail
+// too fine to paint, then quantised with q.
+func RunPaintByNumber(
+	filename string,
+	outputFilename string,
+	q Quantiser,
+	sigma float64,
+	opts PaintByNumberOptions,
+) {
+	fmt.Print("Reading in file...")
+
+	reader, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	fmt.Print(" Done\n")
+	fmt.Print("Decoding file to Image...")
+
+	img, _, err := DecodeImage(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(" Done\n")
+
+	rgba := imageToRGBA(img, opts.Background)
+
+	if sigma > 0 {
+		fmt.Printf("Blurring image with standard deviation %v...", sigma)
+		rgba = GaussianBlurColour(rgba, sigma)
+		fmt.Print(" Done\n")
+	}
+
+	fmt.Printf("Quantising colours with %T...\n", q)
+	paletted := q.Quantise(rgba)
+	fmt.Printf("Quantised to %v colours\n", len(paletted.Palette))
+
+	if fp, ok := q.(FixedPalette); ok && opts.Names == nil {
+		for _, pc := range fp.Palette.Colours {
+			opts.Names = append(opts.Names, pc.Name)
+		}
+	}
+
+	fmt.Print("Drawing paint-by-number sheet...")
+	sheet := PaintByNumber(paletted, opts)
+	fmt.Print(" Done\n")
+
+	fmt.Printf("Saving to output file: \"%v\"", outputFilename)
+	if err := SaveImage(outputFilename, sheet, ""); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(" Done\n")
+}
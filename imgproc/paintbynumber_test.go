@@ -0,0 +1,39 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestNumberRegions(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{255, 255, 255, 255},
+		color.RGBA{255, 0, 0, 255},
+		color.RGBA{0, 0, 255, 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 60, 40), palette)
+
+	// A red square, room enough for a number, and a blue line one pixel wide,
+	// which is too narrow and should be merged into the white background
+	for y := 10; y < 30; y++ {
+		for x := 10; x < 30; x++ {
+			img.SetColorIndex(x, y, 1)
+		}
+		img.SetColorIndex(45, y, 2)
+	}
+
+	regions := NumberRegions(img, DefaultPaintByNumberOptions())
+
+	if len(regions) != 2 {
+		t.Fatalf("Found %v regions, expected 2: %v\n", len(regions), regions)
+	}
+	for _, r := range regions {
+		if r.Colour == 2 {
+			t.Fatalf("Narrow blue region was not merged: %v\n", regions)
+		}
+		if r.Colour == 1 && !r.Pole.In(image.Rect(18, 18, 22, 22)) {
+			t.Fatalf("Pole of red square is %v, expected near its centre\n", r.Pole)
+		}
+	}
+}
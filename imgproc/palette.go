@@ -0,0 +1,272 @@
+package cic
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PaletteColour is a named colour of a palette.
+type PaletteColour struct {
+	Name   string
+	Colour color.RGBA
+}
+
+// Palette is a named list of colours, such as the colours found by a
+// quantiser or the crayons in a box.
+type Palette struct {
+	Name    string
+	Colours []PaletteColour
+}
+
+// NewPalette names the colours of a quantised image's palette by number.
+func NewPalette(name string, p color.Palette) *Palette {
+	pal := Palette{Name: name}
+	for i, c := range p {
+		pal.Colours = append(pal.Colours, PaletteColour{
+			Name:   fmt.Sprintf("Colour %d", i+1),
+			Colour: color.RGBAModel.Convert(c).(color.RGBA),
+		})
+	}
+	return &pal
+}
+
+// ColorPalette returns the colours of the palette, for use in an
+// *image.Paletted.
+func (p *Palette) ColorPalette() color.Palette {
+	cp := make(color.Palette, len(p.Colours))
+	for i, pc := range p.Colours {
+		cp[i] = pc.Colour
+	}
+	return cp
+}
+
+func hexColour(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// ParseHexColour parses a colour written as six hex digits, optionally after
+// a #, such as "#ff8000".
+func ParseHexColour(s string) (color.RGBA, error) {
+	s = strings.TrimPrefix(s, "#")
+	if len(s) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid hex colour %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid hex colour %q", s)
+	}
+	return color.RGBA{uint8(v >> 16), uint8(v >> 8), uint8(v), 255}, nil
+}
+
+// jsonPalette is the layout of a palette in a JSON file.
+type jsonPalette struct {
+	Name    string `json:"name"`
+	Colours []struct {
+		Name string `json:"name"`
+		Hex  string `json:"hex"`
+	} `json:"colours"`
+}
+
+func (p *Palette) WriteJSON(w io.Writer) error {
+	var jp jsonPalette
+	jp.Name = p.Name
+	for _, pc := range p.Colours {
+		jp.Colours = append(jp.Colours, struct {
+			Name string `json:"name"`
+			Hex  string `json:"hex"`
+		}{pc.Name, hexColour(pc.Colour)})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(jp)
+}
+
+// WriteGPL writes the palette in GIMP's .gpl palette format, which Inkscape,
+// Krita and other drawing programs can also read.
+func (p *Palette) WriteGPL(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "GIMP Palette\nName: %s\nColumns: 8\n#\n", p.Name)
+	for _, pc := range p.Colours {
+		fmt.Fprintf(bw, "%3d %3d %3d\t%s\n", pc.Colour.R, pc.Colour.G, pc.Colour.B, pc.Name)
+	}
+	return bw.Flush()
+}
+
+// swatchSize is the width and height in pixels of each colour of a swatch
+// image.
+const swatchSize = 64
+
+// SwatchImage draws the palette as a grid of squares, 8 to a row, each with a
+// thin black border.
+func (p *Palette) SwatchImage() *image.RGBA {
+	columns := min(len(p.Colours), 8)
+	rows := (len(p.Colours) + 7) / 8
+	img := image.NewRGBA(image.Rect(0, 0, max(columns, 1)*swatchSize, max(rows, 1)*swatchSize))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	for i, pc := range p.Colours {
+		square := image.Rect(0, 0, swatchSize, swatchSize).Add(
+			image.Point{(i % 8) * swatchSize, (i / 8) * swatchSize})
+		draw.Draw(img, square.Inset(2), image.Black, image.Point{}, draw.Src)
+		draw.Draw(img, square.Inset(3), &image.Uniform{pc.Colour}, image.Point{}, draw.Src)
+	}
+
+	return img
+}
+
+// Save writes the palette to a file, in a format chosen by the file's
+// extension: .json, .gpl or .png (a swatch image).
+func (p *Palette) Save(filename string) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		err = p.WriteJSON(f)
+	case ".gpl":
+		err = p.WriteGPL(f)
+	case ".png":
+		err = png.Encode(f, p.SwatchImage())
+	default:
+		err = fmt.Errorf("unknown palette format %q (valid extensions are .json, .gpl and .png)", ext)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func ReadPaletteJSON(r io.Reader) (*Palette, error) {
+	var jp jsonPalette
+	if err := json.NewDecoder(r).Decode(&jp); err != nil {
+		return nil, err
+	}
+
+	p := Palette{Name: jp.Name}
+	for _, jc := range jp.Colours {
+		c, err := ParseHexColour(jc.Hex)
+		if err != nil {
+			return nil, err
+		}
+		p.Colours = append(p.Colours, PaletteColour{jc.Name, c})
+	}
+	return &p, nil
+}
+
+func ReadPaletteGPL(r io.Reader) (*Palette, error) {
+	var p Palette
+	scanner := bufio.NewScanner(r)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+
+		switch {
+		case line == 1:
+			if text != "GIMP Palette" {
+				return nil, fmt.Errorf("not a GIMP palette: missing header")
+			}
+			continue
+		case strings.HasPrefix(text, "Name:"):
+			p.Name = strings.TrimSpace(strings.TrimPrefix(text, "Name:"))
+			continue
+		case text == "" || strings.HasPrefix(text, "#") || strings.HasPrefix(text, "Columns:"):
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected red, green and blue values", line)
+		}
+		var rgb [3]uint8
+		for i := range rgb {
+			v, err := strconv.ParseUint(fields[i], 10, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid colour value %q", line, fields[i])
+			}
+			rgb[i] = uint8(v)
+		}
+		p.Colours = append(p.Colours, PaletteColour{
+			Name:   strings.Join(fields[3:], " "),
+			Colour: color.RGBA{rgb[0], rgb[1], rgb[2], 255},
+		})
+	}
+
+	return &p, scanner.Err()
+}
+
+// LoadPalette reads a palette from a .json or .gpl file.
+func LoadPalette(filename string) (*Palette, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var p *Palette
+	switch ext := strings.ToLower(filepath.Ext(filename)); ext {
+	case ".json":
+		p, err = ReadPaletteJSON(f)
+	case ".gpl":
+		p, err = ReadPaletteGPL(f)
+	default:
+		return nil, fmt.Errorf("unknown palette format %q (valid extensions are .json and .gpl)", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	switch {
+	case len(p.Colours) == 0:
+		return nil, fmt.Errorf("%s: palette has no colours", filename)
+	case len(p.Colours) > 256:
+		return nil, fmt.Errorf("%s: palette has %d colours, at most 256 are supported", filename, len(p.Colours))
+	}
+	return p, nil
+}
+
+// FixedPalette is a Quantiser which maps every pixel to the nearest colour of
+// a given palette, measured in the given colour space, rather than learning
+// colours from the image.
+type FixedPalette struct {
+	Palette *Palette
+	Space   ColourSpace
+}
+
+func (fp FixedPalette) Quantise(img *image.RGBA) *image.Paletted {
+	h := NewColourHistogram(img, fp.Space)
+
+	coords := make([]Mean, len(fp.Palette.Colours))
+	for i, pc := range fp.Palette.Colours {
+		coords[i] = Mean(fp.Space.Coordinates(pc.Colour))
+	}
+
+	assignments := make([]int, len(h.Colours))
+	for idx, cc := range h.Colours {
+		best := math.MaxFloat64
+		for i, c := range coords {
+			if dist := sqDist(cc.Coords, c); dist < best {
+				best = dist
+				assignments[idx] = i
+			}
+		}
+	}
+
+	return palettedFromHistogram(img, h, fp.Palette.ColorPalette(), assignments)
+}
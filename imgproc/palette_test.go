@@ -0,0 +1,80 @@
+package cic
+
+import (
+	"bytes"
+	"image/color"
+	"io"
+	"strings"
+	"testing"
+)
+
+var crayons = &Palette{
+	Name: "Crayons",
+	Colours: []PaletteColour{
+		{"Red", color.RGBA{237, 10, 63, 255}},
+		{"Sky Blue", color.RGBA{118, 215, 234, 255}},
+		{"Black", color.RGBA{0, 0, 0, 255}},
+	},
+}
+
+var paletteFormats = map[string]struct {
+	write func(p *Palette, w io.Writer) error
+	read  func(r io.Reader) (*Palette, error)
+}{
+	"json": {(*Palette).WriteJSON, ReadPaletteJSON},
+	"gpl":  {(*Palette).WriteGPL, ReadPaletteGPL},
+}
+
+func TestPaletteRoundTrip(t *testing.T) {
+	for name, f := range paletteFormats {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := f.write(crayons, &buf); err != nil {
+				t.Fatalf("Writing %s palette failed: %v\n", name, err)
+			}
+
+			p, err := f.read(&buf)
+			if err != nil {
+				t.Fatalf("Reading %s palette failed: %v\n", name, err)
+			}
+
+			if p.Name != crayons.Name || len(p.Colours) != len(crayons.Colours) {
+				t.Fatalf("Round trip of %s palette failed. Expected %v, got %v\n", name, crayons, p)
+			}
+			for i := range p.Colours {
+				if p.Colours[i] != crayons.Colours[i] {
+					t.Fatalf("Round trip of %s palette failed. Expected %v, got %v\n", name, crayons, p)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPaletteGPLErrors(t *testing.T) {
+	for name, text := range map[string]string{
+		"missing_header": "Name: Crayons\n255 0 0 Red\n",
+		"short_line":     "GIMP Palette\n255 0\n",
+		"out_of_range":   "GIMP Palette\n256 0 0 Too Red\n",
+	} {
+		if _, err := ReadPaletteGPL(strings.NewReader(text)); err == nil {
+			t.Fatalf("Reading invalid GIMP palette %s succeeded, expected an error\n", name)
+		}
+	}
+}
+
+func TestFixedPalette(t *testing.T) {
+	img := blockImage(2,
+		color.RGBA{200, 30, 60, 255},
+		color.RGBA{20, 20, 20, 255},
+		color.RGBA{100, 200, 250, 255},
+	)
+
+	paletted := FixedPalette{Palette: crayons, Space: LabSpace}.Quantise(img)
+
+	for x, expected := range []uint8{0, 0, 2, 2, 1, 1} {
+		if got := paletted.ColorIndexAt(x, 0); got != expected {
+			t.Fatalf("Pixel %v was mapped to %v, expected %v\n",
+				x, crayons.Colours[got].Name, crayons.Colours[expected].Name)
+		}
+	}
+}
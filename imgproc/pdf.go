@@ -0,0 +1,307 @@
+package cic
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"slices"
+	"sort"
+)
+
+// PaperSizes lists the paper sizes sheets can be printed on, as the width and
+// height in points (1/72 inch) of the paper in portrait orientation.
+var PaperSizes = map[string][2]float64{
+	"a4":     {595.28, 841.89},
+	"a5":     {419.53, 595.28},
+	"letter": {612, 792},
+}
+
+// PDFOptions controls how sheets are placed on the pages of a PDF.
+type PDFOptions struct {
+	// Paper is the paper size, one of PaperSizes.
+	Paper string
+	// Orientation is "portrait", "landscape", or "auto" to turn the page to
+	// match the sheet's aspect ratio.
+	Orientation string
+	// Margin is the smallest space left around the sheet, in millimetres.
+	Margin float64
+	// DPI is the resolution at which a sheet is printed, in pixels per inch.
+	DPI float64
+	// ScaleToFit scales sheets to fill the page inside the margins, rather
+	// than printing them at DPI. Sheets too large for the page at DPI are
+	// always shrunk to fit.
+	ScaleToFit bool
+	// Vector traces the lines of a sheet and embeds them as vector paths,
+	// rather than embedding the raster image.
+	Vector bool
+}
+
+func DefaultPDFOptions() PDFOptions {
+	return PDFOptions{
+		Paper:       "a4",
+		Orientation: "auto",
+		Margin:      10,
+		DPI:         300,
+		ScaleToFit:  true,
+	}
+}
+
+// Validate checks that the paper size and orientation are known, and the
+// margin and DPI usable. The margin must leave room on the page, which is
+// limited by the paper's shorter side whichever way the page is turned.
+func (opts PDFOptions) Validate() error {
+	if _, ok := PaperSizes[opts.Paper]; !ok {
+		names := make([]string, 0, len(PaperSizes))
+		for name := range PaperSizes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown paper size %q (valid options are %v)", opts.Paper, names)
+	}
+	if opts.Orientation != "auto" && opts.Orientation != "portrait" && opts.Orientation != "landscape" {
+		return fmt.Errorf("unknown orientation %q (valid options are auto, portrait and landscape)", opts.Orientation)
+	}
+	if opts.Margin < 0 {
+		return fmt.Errorf("margin must not be negative, got %v", opts.Margin)
+	}
+	size := PaperSizes[opts.Paper]
+	if maxMargin := min(size[0], size[1]) / 2 * 25.4 / 72; opts.Margin >= maxMargin {
+		return fmt.Errorf("margin must be less than %.1fmm to leave room on %v paper, got %v",
+			maxMargin, opts.Paper, opts.Margin)
+	}
+	if opts.DPI <= 0 {
+		return fmt.Errorf("DPI must be positive, got %v", opts.DPI)
+	}
+	return nil
+}
+
+// PDFRect is a rectangle on a PDF page, in points from the top-left corner.
+type PDFRect struct {
+	X, Y, Width, Height float64
+}
+
+// PageSize returns the width and height in points of the page for a sheet
+// of width × height pixels, turned to landscape for a wide sheet if the
+// orientation is "auto".
+func (opts PDFOptions) PageSize(width, height int) (float64, float64) {
+	size := PaperSizes[opts.Paper]
+	pageWidth, pageHeight := size[0], size[1]
+	if opts.Orientation == "landscape" || opts.Orientation == "auto" && width > height {
+		pageWidth, pageHeight = pageHeight, pageWidth
+	}
+	return pageWidth, pageHeight
+}
+
+// Place returns where a sheet of width × height pixels is placed inside the
+// margins of a page of pageWidth × pageHeight points: centred, and scaled
+// to fit or printed at DPI.
+func (opts PDFOptions) Place(width, height int, pageWidth, pageHeight float64) PDFRect {
+	margin := opts.Margin * 72 / 25.4
+	return fitRect(width, height, PDFRect{margin, margin, pageWidth - 2*margin, pageHeight - 2*margin},
+		72/opts.DPI, opts.ScaleToFit)
+}
+
+// fitRect centres content of width × height pixels in area, at scale points
+// per pixel, or scaled to fill area if fill is set or it would not fit.
+func fitRect(width, height int, area PDFRect, scale float64, fill bool) PDFRect {
+	fitScale := min(area.Width/float64(width), area.Height/float64(height))
+	if fill || scale > fitScale {
+		scale = fitScale
+	}
+	w, h := float64(width)*scale, float64(height)*scale
+	return PDFRect{area.X + (area.Width-w)/2, area.Y + (area.Height-h)/2, w, h}
+}
+
+// pdfNum formats a number for a PDF content stream, precisely enough for
+// scale factors.
+func pdfNum(v float64) string {
+	return formatNum(v, 4)
+}
+
+// PDFDocument builds a PDF file page by page.
+type PDFDocument struct {
+	// objects holds the body of each object, numbered from 1. Objects 1 and 2
+	// are the page tree and catalog, written last.
+	objects [][]byte
+	pages   []*PDFPage
+	font    int
+}
+
+// PDFPage is a page of a PDFDocument, drawn on in points from the top-left
+// corner.
+type PDFPage struct {
+	doc           *PDFDocument
+	Width, Height float64
+	content       bytes.Buffer
+	xObjects      []PDFXObject
+	font          bool
+}
+
+// PDFXObject is an image or drawing added to a PDFDocument, which can be
+// drawn any number of times on its pages.
+type PDFXObject int
+
+func NewPDFDocument() *PDFDocument {
+	return &PDFDocument{objects: make([][]byte, 2)}
+}
+
+// addObject adds an object to the document, returning its number.
+func (d *PDFDocument) addObject(body []byte) int {
+	d.objects = append(d.objects, body)
+	return len(d.objects)
+}
+
+// addStream adds a stream object, compressed with Flate, with the given
+// extra dictionary entries.
+func (d *PDFDocument) addStream(dict string, data []byte) int {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	var body bytes.Buffer
+	fmt.Fprintf(&body, "<< %s /Filter /FlateDecode /Length %d >>\nstream\n", dict, compressed.Len())
+	body.Write(compressed.Bytes())
+	body.WriteString("\nendstream")
+	return d.addObject(body.Bytes())
+}
+
+// AddPage adds a blank page of width × height points to the document.
+func (d *PDFDocument) AddPage(width, height float64) *PDFPage {
+	page := &PDFPage{doc: d, Width: width, Height: height}
+	d.pages = append(d.pages, page)
+	return page
+}
+
+// AddImage adds img to the document. Gray images are embedded as gray, and
+// all others as RGB.
+func (d *PDFDocument) AddImage(img image.Image) PDFXObject {
+	bounds := img.Bounds()
+
+	var pix []byte
+	colourSpace := "/DeviceRGB"
+	if gray, ok := img.(*image.Gray); ok {
+		colourSpace = "/DeviceGray"
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			start := gray.PixOffset(bounds.Min.X, y)
+			pix = append(pix, gray.Pix[start:start+bounds.Dx()]...)
+		}
+	} else {
+		pix = make([]byte, 0, 3*bounds.Dx()*bounds.Dy())
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+				pix = append(pix, c.R, c.G, c.B)
+			}
+		}
+	}
+
+	return PDFXObject(d.addStream(fmt.Sprintf(
+		"/Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8",
+		bounds.Dx(), bounds.Dy(), colourSpace), pix))
+}
+
+// AddPaths adds a drawing of paths, stroked in black with round pens of the
+// given widths, to the document. Path coordinates and widths are in pixels of
+// an image of width × height, and paths of a single point are drawn as dots.
+func (d *PDFDocument) AddPaths(paths []Path, widths []float64, width, height int) PDFXObject {
+	var c bytes.Buffer
+	c.WriteString("1 J 1 j 0 G\n")
+
+	for i, p := range paths {
+		fmt.Fprintf(&c, "%s w %s %s m", pdfNum(widths[i]), pdfNum(p.Start.X), pdfNum(p.Start.Y))
+		if len(p.Segments) == 0 {
+			// A zero length line with round caps is a dot
+			fmt.Fprintf(&c, " %s %s l", pdfNum(p.Start.X), pdfNum(p.Start.Y))
+		}
+		for _, seg := range p.Segments {
+			if seg.Curve {
+				fmt.Fprintf(&c, " %s %s %s %s %s %s c",
+					pdfNum(seg.C1.X), pdfNum(seg.C1.Y),
+					pdfNum(seg.C2.X), pdfNum(seg.C2.Y),
+					pdfNum(seg.End.X), pdfNum(seg.End.Y))
+			} else {
+				fmt.Fprintf(&c, " %s %s l", pdfNum(seg.End.X), pdfNum(seg.End.Y))
+			}
+		}
+		if p.Closed {
+			c.WriteString(" h")
+		}
+		c.WriteString(" S\n")
+	}
+
+	// The matrix maps the pixels onto the unit square, as for an image,
+	// flipping the y axis so they run down the page
+	return PDFXObject(d.addStream(fmt.Sprintf(
+		"/Type /XObject /Subtype /Form /BBox [0 0 %d %d] /Matrix [%s 0 0 %s 0 1]",
+		width, height, formatNum(1/float64(width), 10), formatNum(-1/float64(height), 10)), c.Bytes()))
+}
+
+// Draw draws x, an image or drawing added to the page's document, filling r.
+func (pg *PDFPage) Draw(x PDFXObject, r PDFRect) {
+	if !slices.Contains(pg.xObjects, x) {
+		pg.xObjects = append(pg.xObjects, x)
+	}
+	fmt.Fprintf(&pg.content, "q %s 0 0 %s %s %s cm /X%d Do Q\n",
+		pdfNum(r.Width), pdfNum(r.Height), pdfNum(r.X), pdfNum(pg.Height-r.Y-r.Height), x)
+}
+
+// StrokeRect outlines r with a line of the given width in points, and gray
+// level from 0 (black) to 1 (white).
+func (pg *PDFPage) StrokeRect(r PDFRect, width, gray float64) {
+	fmt.Fprintf(&pg.content, "q %s w %s G %s %s %s %s re S Q\n",
+		pdfNum(width), pdfNum(gray), pdfNum(r.X), pdfNum(pg.Height-r.Y-r.Height), pdfNum(r.Width), pdfNum(r.Height))
+}
+
+// Write writes the document as a PDF file. It finishes the document, so is
+// called once, after all pages are drawn.
+func (d *PDFDocument) Write(w io.Writer) error {
+	var kids bytes.Buffer
+	for _, page := range d.pages {
+		content := d.addStream("", page.content.Bytes())
+
+		var resources bytes.Buffer
+		resources.WriteString("/XObject <<")
+		for _, x := range page.xObjects {
+			fmt.Fprintf(&resources, " /X%d %d 0 R", x, x)
+		}
+		resources.WriteString(" >>")
+		if page.font {
+			fmt.Fprintf(&resources, " /Font << /F1 %d 0 R >>", d.font)
+		}
+
+		obj := d.addObject([]byte(fmt.Sprintf(
+			"<< /Type /Page /Parent 1 0 R /MediaBox [0 0 %s %s] /Resources << %s >> /Contents %d 0 R >>",
+			pdfNum(page.Width), pdfNum(page.Height), resources.String(), content)))
+		fmt.Fprintf(&kids, " %d 0 R", obj)
+	}
+	d.objects[0] = []byte(fmt.Sprintf("<< /Type /Pages /Kids [%s ] /Count %d >>", kids.String(), len(d.pages)))
+	d.objects[1] = []byte("<< /Type /Catalog /Pages 1 0 R >>")
+
+	bw := bufio.NewWriter(w)
+	offset := 0
+	write := func(format string, a ...any) {
+		n, _ := fmt.Fprintf(bw, format, a...)
+		offset += n
+	}
+
+	// The comment of high bytes marks the file as binary
+	write("%%PDF-1.4\n%%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = offset
+		write("%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := offset
+	write("xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, o := range offsets {
+		write("%010d 00000 n \n", o)
+	}
+	write("trailer\n<< /Size %d /Root 2 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+	return bw.Flush()
+}
@@ -0,0 +1,112 @@
+package cic
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"math"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestPDFLayout(t *testing.T) {
+	opts := DefaultPDFOptions()
+
+	// A wide sheet turns the page to landscape, and is scaled to fill it
+	// inside the margins
+	pageWidth, pageHeight := opts.PageSize(400, 200)
+	if pageWidth != 841.89 || pageHeight != 595.28 {
+		t.Fatalf("Page for wide sheet is %v × %v, expected landscape A4\n", pageWidth, pageHeight)
+	}
+	r := opts.Place(400, 200, pageWidth, pageHeight)
+	margin := 10 * 72 / 25.4
+	if math.Abs(r.X-margin) > 1e-9 || math.Abs(r.Width-(pageWidth-2*margin)) > 1e-9 {
+		t.Fatalf("Wide sheet placed at %+v, expected to fill the width inside the margins\n", r)
+	}
+	if math.Abs(r.Y+r.Height/2-pageHeight/2) > 1e-9 {
+		t.Fatalf("Wide sheet placed at %+v, expected to be centred\n", r)
+	}
+
+	// Without scaling to fit, a sheet is printed at DPI
+	opts.ScaleToFit = false
+	opts.DPI = 144
+	pageWidth, pageHeight = opts.PageSize(200, 300)
+	r = opts.Place(200, 300, pageWidth, pageHeight)
+	if pageWidth != 595.28 || r.Width != 100 || r.Height != 150 {
+		t.Fatalf("Sheet at 144 DPI placed at %+v on page %v wide, expected 100 × 150 on portrait A4\n",
+			r, pageWidth)
+	}
+
+	opts.Paper = "b5"
+	if opts.Validate() == nil {
+		t.Fatalf("Unknown paper size was accepted\n")
+	}
+
+	// A5 is 148mm across, so margins of more than half that leave no room in
+	// either orientation
+	opts.Paper = "a5"
+	for _, orientation := range []string{"portrait", "landscape", "auto"} {
+		opts.Orientation = orientation
+		opts.Margin = 70
+		if err := opts.Validate(); err != nil {
+			t.Fatalf("Margin of 70mm on %v A5 was rejected: %v\n", orientation, err)
+		}
+		opts.Margin = 75
+		if opts.Validate() == nil {
+			t.Fatalf("Margin of 75mm on %v A5 was accepted\n", orientation)
+		}
+	}
+}
+
+func TestPDFDocument(t *testing.T) {
+	doc := NewPDFDocument()
+	img := doc.AddImage(image.NewGray(image.Rect(0, 0, 4, 4)))
+	lines := doc.AddPaths([]Path{{Start: Vec2{1, 1}, Segments: []PathSegment{{End: Vec2{3, 1}}}}},
+		[]float64{2}, 4, 4)
+	page := doc.AddPage(100, 200)
+	page.Draw(img, PDFRect{10, 10, 80, 80})
+	page.DrawText("Title (1)", 10, 190, 12)
+	doc.AddPage(200, 100).Draw(lines, PDFRect{10, 10, 80, 80})
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatalf("Writing PDF failed: %v\n", err)
+	}
+	pdf := buf.Bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("PDF does not start with a header and end with an end of file marker\n")
+	}
+	if !bytes.Contains(pdf, []byte("/Count 2")) {
+		t.Fatalf("PDF page tree does not count 2 pages\n")
+	}
+	if !bytes.Contains(pdf, []byte("/Font << /F1")) {
+		t.Fatalf("PDF page with text does not use the font\n")
+	}
+	if !bytes.Contains(pdf, []byte(`(Title \(1\)) Tj`)) {
+		t.Fatalf("PDF text is not escaped\n")
+	}
+
+	// Text is measured with the embedded font
+	if w := TextWidth("ii", 10); w <= 0 || w >= TextWidth("WW", 10) {
+		t.Fatalf("Text widths are not proportional: \"ii\" is %v wide\n", w)
+	}
+
+	// Each cross-reference entry gives the offset of its object
+	m := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatalf("PDF has no startxref\n")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	entries := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(pdf[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatalf("PDF cross-reference table is empty\n")
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(string(entry[1]))
+		if !bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Fatalf("Cross-reference entry for object %d does not point to it\n", i+1)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package cic
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Text in PDFs is set in Go Regular, embedded as a TrueType font with the
+// WinAnsi encoding, which covers Latin-1 and some common punctuation.
+
+// winAnsiExtras maps the characters of the WinAnsi encoding between 128 and
+// 159, where it differs from Latin-1, to their bytes.
+var winAnsiExtras = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '‘': 0x91, '’': 0x92,
+	'“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '™': 0x99,
+}
+
+// winAnsiByte returns the byte encoding r in WinAnsi, and whether it has one.
+func winAnsiByte(r rune) (byte, bool) {
+	if r >= 32 && r < 127 || r >= 160 && r < 256 {
+		return byte(r), true
+	}
+	b, ok := winAnsiExtras[r]
+	return b, ok
+}
+
+// winAnsiRune returns the character encoded by b in WinAnsi, or 0 if none.
+func winAnsiRune(b byte) rune {
+	if b >= 32 && b < 127 || b >= 160 {
+		return rune(b)
+	}
+	for r, eb := range winAnsiExtras {
+		if eb == b {
+			return r
+		}
+	}
+	return 0
+}
+
+// encodeText encodes text in WinAnsi, replacing characters it can't encode
+// with question marks.
+func encodeText(text string) []byte {
+	var out []byte
+	for _, r := range text {
+		b, ok := winAnsiByte(r)
+		if !ok {
+			b = '?'
+		}
+		out = append(out, b)
+	}
+	return out
+}
+
+var (
+	pdfFontOnce sync.Once
+	// pdfFontWidths holds the advance of each WinAnsi character in
+	// thousandths of an em, as PDF font widths are given.
+	pdfFontWidths [256]int
+	// pdfFontDescriptor holds the font's bounding box and vertical metrics,
+	// in thousandths of an em.
+	pdfFontDescriptor string
+)
+
+// loadPDFFont measures Go Regular for embedding in PDFs.
+func loadPDFFont() {
+	pdfFontOnce.Do(func() {
+		f := regularFont()
+		var buf sfnt.Buffer
+		ppem := fixed.I(1000)
+		units := func(v fixed.Int26_6) int { return int(math.Round(float64(v) / 64)) }
+
+		for b := 0; b < 256; b++ {
+			r := winAnsiRune(byte(b))
+			if r == 0 {
+				continue
+			}
+			idx, err := f.GlyphIndex(&buf, r)
+			if err != nil || idx == 0 {
+				continue
+			}
+			adv, err := f.GlyphAdvance(&buf, idx, ppem, font.HintingNone)
+			if err != nil {
+				log.Fatal(err)
+			}
+			pdfFontWidths[b] = units(adv)
+		}
+
+		bounds, err := f.Bounds(&buf, ppem, font.HintingNone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		metrics, err := f.Metrics(&buf, ppem, font.HintingNone)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// The font's y axis runs down the page, and PDF's up
+		pdfFontDescriptor = fmt.Sprintf(
+			"/FontBBox [%d %d %d %d] /Ascent %d /Descent %d /CapHeight %d",
+			units(bounds.Min.X), -units(bounds.Max.Y), units(bounds.Max.X), -units(bounds.Min.Y),
+			units(metrics.Ascent), -units(metrics.Descent), units(metrics.CapHeight))
+	})
+}
+
+// TextWidth returns the width in points of text set at size points in a PDF.
+func TextWidth(text string, size float64) float64 {
+	loadPDFFont()
+	width := 0
+	for _, b := range encodeText(text) {
+		width += pdfFontWidths[b]
+	}
+	return float64(width) * size / 1000
+}
+
+// addFont embeds the font in the document, once, returning its object number.
+func (d *PDFDocument) addFont() int {
+	if d.font != 0 {
+		return d.font
+	}
+	loadPDFFont()
+
+	file := d.addStream(fmt.Sprintf("/Length1 %d", len(goregular.TTF)), goregular.TTF)
+	descriptor := d.addObject([]byte(fmt.Sprintf(
+		"<< /Type /FontDescriptor /FontName /GoRegular /Flags 32 %s /ItalicAngle 0 /StemV 80 /FontFile2 %d 0 R >>",
+		pdfFontDescriptor, file)))
+
+	var widths strings.Builder
+	for b := 32; b < 256; b++ {
+		fmt.Fprintf(&widths, " %d", pdfFontWidths[b])
+	}
+	d.font = d.addObject([]byte(fmt.Sprintf(
+		"<< /Type /Font /Subtype /TrueType /BaseFont /GoRegular /FirstChar 32 /LastChar 255 /Widths [%s ] /Encoding /WinAnsiEncoding /FontDescriptor %d 0 R >>",
+		widths.String(), descriptor)))
+	return d.font
+}
+
+// DrawText sets text in black at size points, starting from (x, y) on its
+// baseline.
+func (pg *PDFPage) DrawText(text string, x, y, size float64) {
+	pg.doc.addFont()
+	pg.font = true
+
+	// Escape the delimiters of a PDF string
+	var s bytes.Buffer
+	for _, b := range encodeText(text) {
+		if b == '(' || b == ')' || b == '\\' {
+			s.WriteByte('\\')
+		}
+		s.WriteByte(b)
+	}
+
+	fmt.Fprintf(&pg.content, "BT /F1 %s Tf 0 g %s %s Td (%s) Tj ET\n",
+		pdfNum(size), pdfNum(x), pdfNum(pg.Height-y), s.Bytes())
+}
@@ -0,0 +1,140 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Quantiser reduces the colours of an image to a small palette, returning the
+// image drawn in that palette.
+type Quantiser interface {
+	Quantise(img *image.RGBA) *image.Paletted
+}
+
+// QuantiserMethods lists the names accepted by NewQuantiser.
+var QuantiserMethods = []string{"kmeans", "mediancut", "octree", "wu"}
+
+// NewQuantiser returns the quantiser named by method. opts.K gives the number
+// of colours for every method; the remaining options only apply to k-means.
+// Only k-means can choose the number of colours itself, with an opts.K of zero.
+func NewQuantiser(method string, opts KMeansOptions) (Quantiser, error) {
+	if opts.K == 0 && method != "kmeans" {
+		return nil, fmt.Errorf("the %v method can't choose the number of colours automatically", method)
+	}
+
+	switch method {
+	case "kmeans":
+		return NewKMeansQuantiser(opts), nil
+	case "mediancut":
+		return MedianCut{K: opts.K}, nil
+	case "octree":
+		return Octree{K: opts.K}, nil
+	case "wu":
+		return Wu{K: opts.K}, nil
+	default:
+		return nil, fmt.Errorf("unknown quantisation method %q (valid options are %v)", method, QuantiserMethods)
+	}
+}
+
+// paletteSize limits the requested number of colours to what an
+// *image.Paletted can index.
+func paletteSize(k int) int {
+	switch {
+	case k < 1:
+		return 1
+	case k > 256:
+		return 256
+	default:
+		return k
+	}
+}
+
+// palettedFromHistogram draws img in the given palette, where assignments gives
+// the palette index for each entry of the image's colour histogram h.
+func palettedFromHistogram(img *image.RGBA, h *ColourHistogram, palette color.Palette, assignments []int) *image.Paletted {
+	bounds := img.Bounds()
+	dst := image.NewPaletted(bounds, palette)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			px := img.RGBAAt(x, y)
+			if idx := h.EntryAt(x, y, px); idx >= 0 {
+				dst.SetColorIndex(x, y, uint8(assignments[idx]))
+			} else {
+				dst.SetColorIndex(x, y, uint8(palette.Index(px)))
+			}
+		}
+	}
+
+	return dst
+}
+
+// RunQuantiseImage reduces the colours of an image file with the quantiser q,
+// and, if minRegionSize is above zero, merges regions smaller than that into
+// their neighbours. The resulting palette is saved to each of paletteFiles.
+// Transparent parts of the image are composited onto bg, or white if it's nil.
+func RunQuantiseImage(
+	filename string,
+	outputFilename string,
+	q Quantiser,
+	minRegionSize int,
+	paletteFiles []string,
+	bg color.Color,
+) {
+	fmt.Print("Reading in file...")
+
+	reader, err := os.Open(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer reader.Close()
+
+	fmt.Print(" Done\n")
+	fmt.Print("Decoding file to Image...")
+
+	img, _, err := DecodeImage(reader)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Print(" Done\n")
+
+	fmt.Print("Convert to RBGA format...")
+	rgba := imageToRGBA(img, bg)
+	fmt.Print(" Done\n")
+
+	fmt.Printf("Quantising colours with %T...\n", q)
+	paletted := q.Quantise(rgba)
+	fmt.Printf("Quantised to %v colours\n", len(paletted.Palette))
+
+	if minRegionSize > 0 {
+		fmt.Printf("Merging regions smaller than %v pixels...", minRegionSize)
+		paletted = RemoveSmallRegions(paletted, minRegionSize)
+		fmt.Print(" Done\n")
+	}
+
+	if len(paletteFiles) > 0 {
+		palette := NewPalette(strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)), paletted.Palette)
+		if fp, ok := q.(FixedPalette); ok {
+			palette = fp.Palette
+		}
+		for _, paletteFile := range paletteFiles {
+			fmt.Printf("Saving palette to \"%v\"...", paletteFile)
+			if err := palette.Save(paletteFile); err != nil {
+				log.Fatal(err)
+			}
+			fmt.Print(" Done\n")
+		}
+	}
+
+	fmt.Printf("Saving to output file: \"%v\"", outputFilename)
+	if err := SaveImage(outputFilename, paletted, ""); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Print(" Done\n")
+}
@@ -0,0 +1,137 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+var quantisers = map[string]Quantiser{
+	"kmeans": NewKMeansQuantiser(KMeansOptions{
+		K:             4,
+		MaxIterations: 50,
+		Tolerance:     1e-4,
+		Restarts:      3,
+		Seed:          42,
+	}),
+	"mediancut": MedianCut{K: 4},
+	"octree":    Octree{K: 4},
+	"wu":        Wu{K: 4},
+}
+
+func TestQuantiseExactColours(t *testing.T) {
+	// Colours are well separated, so that every quantiser should find them
+	// exactly when asked for as many colours as there are.
+	colours := []color.RGBA{
+		{200, 16, 16, 255},
+		{16, 200, 16, 255},
+		{16, 16, 200, 255},
+		{240, 240, 240, 255},
+	}
+	img := blockImage(3, colours...)
+
+	for name, q := range quantisers {
+		t.Run(name, func(t *testing.T) {
+			paletted := q.Quantise(img)
+
+			bounds := img.Bounds()
+			for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+				for x := bounds.Min.X; x < bounds.Max.X; x++ {
+					got := color.RGBAModel.Convert(paletted.At(x, y)).(color.RGBA)
+					if got != img.RGBAAt(x, y) {
+						t.Fatalf("Quantiser %s set pixel (%v, %v) to %v, expected %v\n",
+							name, x, y, got, img.RGBAAt(x, y))
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestQuantiseDeterministic(t *testing.T) {
+	img := blockImage(2,
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{60, 30, 10, 255},
+		color.RGBA{120, 60, 20, 255},
+		color.RGBA{180, 90, 30, 255},
+		color.RGBA{240, 120, 40, 255},
+		color.RGBA{250, 250, 250, 255},
+	)
+
+	for name, q := range quantisers {
+		t.Run(name, func(t *testing.T) {
+			first := q.Quantise(img)
+			second := q.Quantise(img)
+
+			for i := range first.Pix {
+				c1 := first.Palette[first.Pix[i]]
+				c2 := second.Palette[second.Pix[i]]
+				if c1 != c2 {
+					t.Fatalf("Quantiser %s gave different results on repeated runs: %v and %v\n",
+						name, c1, c2)
+				}
+			}
+		})
+	}
+}
+
+func TestQuantiseAutoK(t *testing.T) {
+	colours := []color.RGBA{
+		{200, 16, 16, 255},
+		{16, 200, 16, 255},
+		{16, 16, 200, 255},
+		{240, 240, 240, 255},
+	}
+	img := blockImage(3, colours...)
+
+	opts := DefaultKMeansOptions(0)
+	opts.Seed = 42
+	q, err := NewQuantiser("kmeans", opts)
+	if err != nil {
+		t.Fatalf("Creating k-means quantiser choosing k failed: %v\n", err)
+	}
+	if got := len(q.Quantise(img).Palette); got != len(colours) {
+		t.Errorf("Choosing k found %v colours, expected %v\n", got, len(colours))
+	}
+
+	for _, method := range []string{"mediancut", "octree", "wu"} {
+		if _, err := NewQuantiser(method, opts); err == nil {
+			t.Errorf("Expected an error choosing k with the %v method\n", method)
+		}
+	}
+}
+
+func TestRemoveSmallRegions(t *testing.T) {
+	palette := color.Palette{
+		color.RGBA{0, 0, 0, 255},
+		color.RGBA{255, 255, 255, 255},
+		color.RGBA{255, 0, 0, 255},
+	}
+	img := image.NewPaletted(image.Rect(0, 0, 10, 10), palette)
+
+	// Right half white, with a 2 pixel red speckle in each half
+	for y := 0; y < 10; y++ {
+		for x := 5; x < 10; x++ {
+			img.SetColorIndex(x, y, 1)
+		}
+	}
+	img.SetColorIndex(1, 1, 2)
+	img.SetColorIndex(2, 1, 2)
+	img.SetColorIndex(7, 7, 2)
+	img.SetColorIndex(7, 8, 2)
+
+	img = RemoveSmallRegions(img, 3)
+
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			expected := uint8(0)
+			if x >= 5 {
+				expected = 1
+			}
+			if got := img.ColorIndexAt(x, y); got != expected {
+				t.Fatalf("Pixel (%v, %v) has palette index %v after removing small regions, expected %v\n",
+					x, y, got, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+)
+
+// lineThreshold is the gray level at and below which a pixel of a finished
+// colouring sheet counts as part of a line. Stroked lines are black but for
+// their anti-aliased fringe, and thickened lines are drawn at 191 or darker.
+const lineThreshold = 191
+
+// RegionReport describes the closed regions of a colouring sheet: the
+// 4-connected areas of pixels lighter than a threshold, i.e. the areas which a
+// flood-fill colouring app would fill with a single tap.
+type RegionReport struct {
+	// Labels holds the region of each pixel in raster order, or -1 for line
+	// pixels.
+	Labels []int
+	// Sizes holds the size of each region in pixels.
+	Sizes []int
+	// Border reports, for each region, whether it touches the edge of the
+	// image.
+	Border []bool
+}
+
+// AnalyseRegions labels the regions of img separated by lines of pixels with
+// gray level threshold or darker.
+func AnalyseRegions(img *image.Gray, threshold uint8) *RegionReport {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	background := func(idx int) bool {
+		return img.GrayAt(bounds.Min.X+idx%width, bounds.Min.Y+idx/width).Y > threshold
+	}
+	labels, sizes := LabelComponents(width, height, 4, background, func(a, b int) bool { return true })
+
+	border := make([]bool, len(sizes))
+	for idx, label := range labels {
+		x, y := idx%width, idx/width
+		if label >= 0 && (x == 0 || y == 0 || x == width-1 || y == height-1) {
+			border[label] = true
+		}
+	}
+
+	return &RegionReport{Labels: labels, Sizes: sizes, Border: border}
+}
+
+// Count returns the number of regions.
+func (r *RegionReport) Count() int {
+	return len(r.Sizes)
+}
+
+// String summarises the number of regions and the distribution of their
+// sizes, in bins of powers of ten.
+func (r *RegionReport) String() string {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "Found %v regions", r.Count())
+	if r.Count() == 0 {
+		sb.WriteString("\n")
+		return sb.String()
+	}
+
+	sizes := append([]int(nil), r.Sizes...)
+	sort.Ints(sizes)
+	borders := 0
+	for _, b := range r.Border {
+		if b {
+			borders++
+		}
+	}
+	fmt.Fprintf(&sb, " (%v touching the image edge)\n", borders)
+	fmt.Fprintf(&sb, "Region sizes: smallest %v, median %v, largest %v pixels\n",
+		sizes[0], sizes[len(sizes)/2], sizes[len(sizes)-1])
+
+	sb.WriteString("  Size (pixels)    Regions\n")
+	for lo := 1; lo <= sizes[len(sizes)-1]; lo *= 10 {
+		n := sort.SearchInts(sizes, 10*lo) - sort.SearchInts(sizes, lo)
+		fmt.Fprintf(&sb, "  %6v - %-7v  %7v\n", lo, 10*lo-1, n)
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+// squareOutline returns gradients of a width × height image with the outline
+// of a square from (lo, lo) to (hi, hi), less the pixels in gap.
+func squareOutline(width, height, lo, hi int, gap ...image.Point) *ImageGradients {
+	ig := CreateImageGradients(width, height)
+	for i := lo; i <= hi; i++ {
+		ig.Value[lo][i], ig.Value[hi][i] = 200, 200
+		ig.Value[i][lo], ig.Value[i][hi] = 200, 200
+		ig.Direction[lo][i], ig.Direction[hi][i] = ninety, ninety
+	}
+	for _, p := range gap {
+		ig.Value[p.Y][p.X] = 0
+	}
+	return ig
+}
+
+func TestAnalyseRegions(t *testing.T) {
+	img := InvertGrayscaleImage(squareOutline(20, 20, 5, 14).GrayscaleImage())
+
+	report := AnalyseRegions(img, lineThreshold)
+
+	if report.Count() != 2 {
+		t.Fatalf("Found %v regions, expected 2\n", report.Count())
+	}
+	if inside := report.Sizes[report.Labels[10*20+10]]; inside != 8*8 {
+		t.Fatalf("Inside of square has %v pixels, expected %v\n", inside, 8*8)
+	}
+	if report.Border[report.Labels[10*20+10]] {
+		t.Fatalf("Inside of square is reported as touching the image edge\n")
+	}
+}
+
+func TestBridgeGaps(t *testing.T) {
+	ig := squareOutline(30, 30, 4, 25, image.Point{14, 4}, image.Point{15, 4})
+
+	img := InvertGrayscaleImage(ig.GrayscaleImage())
+	if n := AnalyseRegions(img, lineThreshold).Count(); n != 1 {
+		t.Fatalf("Found %v regions in broken square, expected 1\n", n)
+	}
+
+	img = InvertGrayscaleImage(ig.BridgeGaps(GapOptions{MaxGap: 3, MaxAngle: 30}).GrayscaleImage())
+	if n := AnalyseRegions(img, lineThreshold).Count(); n != 2 {
+		t.Fatalf("Found %v regions after closing gaps, expected 2\n", n)
+	}
+	if c := img.GrayAt(14, 4); c != (color.Gray{255 - 200}) {
+		t.Fatalf("Gap pixel is %v after closing gaps, expected %v\n", c, color.Gray{255 - 200})
+	}
+}
+
+func TestBridgeGapsNeedsThinning(t *testing.T) {
+	// An outline three pixels thick, as non-maximum suppression can leave,
+	// broken by a gap two pixels wide
+	thickOutline := func() *ImageGradients {
+		ig := CreateImageGradients(30, 30)
+		for k := 0; k < 3; k++ {
+			outline := squareOutline(30, 30, 4+k, 25-k)
+			for j := range outline.Value {
+				for i, v := range outline.Value[j] {
+					if v > 0 {
+						ig.Value[j][i], ig.Direction[j][i] = v, outline.Direction[j][i]
+					}
+				}
+			}
+		}
+		for y := 4; y <= 6; y++ {
+			ig.Value[y][14], ig.Value[y][15] = 0, 0
+		}
+		return ig
+	}
+	regions := func(ig *ImageGradients) int {
+		return AnalyseRegions(InvertGrayscaleImage(ig.GrayscaleImage()), lineThreshold).Count()
+	}
+	// Thinning shortens the broken ends, widening the gap
+	opts := GapOptions{MaxGap: 6, MaxAngle: 30}
+
+	// A thick line has no ends to bridge from
+	if n := regions(thickOutline().BridgeGaps(opts)); n != 1 {
+		t.Fatalf("Found %v regions after closing gaps in thick lines, expected 1\n", n)
+	}
+	if n := regions(thickOutline().Thin().BridgeGaps(opts)); n != 2 {
+		t.Fatalf("Found %v regions after thinning and closing gaps, expected 2\n", n)
+	}
+}
+
+func TestBridgeGapsCone(t *testing.T) {
+	ig := CreateImageGradients(20, 20)
+	for x := 2; x <= 10; x++ {
+		ig.Value[10][x] = 200
+	}
+	// Edge pixels beside and ahead of the line's end at (10, 10)
+	ig.Value[14][10] = 100
+	ig.Value[10][14] = 100
+
+	ig.BridgeGaps(GapOptions{MaxGap: 5, MaxAngle: 30})
+
+	for x := 11; x < 14; x++ {
+		if ig.Value[10][x] != 100 {
+			t.Fatalf("Gap ahead of line was not bridged at (%v, 10)\n", x)
+		}
+	}
+	for y := 11; y < 14; y++ {
+		if ig.Value[y][10] != 0 {
+			t.Fatalf("Line was bridged at (10, %v), outside the search cone\n", y)
+		}
+	}
+}
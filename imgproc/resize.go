@@ -0,0 +1,318 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ResizeOptions controls the stage which crops and resizes the image before
+// edges are found, so that the detail of the sheet suits its printed size.
+type ResizeOptions struct {
+	// Crop, if not empty, is the part of the image to keep, in pixels from
+	// its top left corner.
+	Crop image.Rectangle
+	// Trim crops away borders of a uniform colour.
+	Trim bool
+	// Width and Height resize the image to a width or height in pixels,
+	// keeping its shape if only one is given. MaxSize then shrinks the image
+	// so that neither side is longer, if it is more than 0.
+	Width, Height, MaxSize int
+	// Filter is the resampling filter, one of ResampleFilters.
+	Filter string
+}
+
+// ResampleFilters lists the values accepted for ResizeOptions.Filter.
+var ResampleFilters = []string{"lanczos", "bicubic", "box"}
+
+// Validate checks that the options are consistent.
+func (o ResizeOptions) Validate() error {
+	if o.Width < 0 || o.Height < 0 || o.MaxSize < 0 {
+		return fmt.Errorf("sizes can't be negative")
+	}
+	if _, ok := resampleFilters[o.Filter]; !ok {
+		return fmt.Errorf("unknown resampling filter %q (valid options are %v)", o.Filter, ResampleFilters)
+	}
+	return nil
+}
+
+// ParseCrop parses the part of an image to crop to, given as "x,y,w,h".
+func ParseCrop(s string) (image.Rectangle, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop %q (expected x,y,w,h)", s)
+	}
+	var v [4]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 {
+			return image.Rectangle{}, fmt.Errorf("invalid crop %q (expected x,y,w,h)", s)
+		}
+		v[i] = n
+	}
+	if v[2] == 0 || v[3] == 0 {
+		return image.Rectangle{}, fmt.Errorf("invalid crop %q: width and height must be more than 0", s)
+	}
+	return image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]), nil
+}
+
+// trimTolerance is how far each channel of a pixel, from 0 to 255, may differ
+// from the border's colour and still be trimmed with it, so that noise and
+// JPEG artefacts don't stop borders being trimmed.
+const trimTolerance = 16
+
+// TrimBounds returns the bounds of img without its borders of a uniform
+// colour, that of its top left pixel. An image of a uniform colour is left
+// whole.
+func TrimBounds(img image.Image) image.Rectangle {
+	bounds := img.Bounds()
+	br, bg, bb, ba := img.At(bounds.Min.X, bounds.Min.Y).RGBA()
+
+	near := func(a, b uint32) bool {
+		return max(a, b)-min(a, b) <= trimTolerance*0x101
+	}
+	border := func(x, y int) bool {
+		r, g, b, a := img.At(x, y).RGBA()
+		return near(r, br) && near(g, bg) && near(b, bb) && near(a, ba)
+	}
+	borderRow := func(y, x0, x1 int) bool {
+		for x := x0; x < x1; x++ {
+			if !border(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+	borderColumn := func(x, y0, y1 int) bool {
+		for y := y0; y < y1; y++ {
+			if !border(x, y) {
+				return false
+			}
+		}
+		return true
+	}
+
+	r := bounds
+	for r.Min.Y < r.Max.Y && borderRow(r.Min.Y, r.Min.X, r.Max.X) {
+		r.Min.Y++
+	}
+	if r.Empty() {
+		return bounds
+	}
+	for borderRow(r.Max.Y-1, r.Min.X, r.Max.X) {
+		r.Max.Y--
+	}
+	for borderColumn(r.Min.X, r.Min.Y, r.Max.Y) {
+		r.Min.X++
+	}
+	for borderColumn(r.Max.X-1, r.Min.Y, r.Max.Y) {
+		r.Max.X--
+	}
+	return r
+}
+
+// Size returns the size to resize an image of width w and height h to.
+func (o ResizeOptions) Size(w, h int) (int, int) {
+	outW, outH := w, h
+	switch {
+	case o.Width > 0 && o.Height > 0:
+		outW, outH = o.Width, o.Height
+	case o.Width > 0:
+		outW, outH = o.Width, int(math.Round(float64(h)*float64(o.Width)/float64(w)))
+	case o.Height > 0:
+		outW, outH = int(math.Round(float64(w)*float64(o.Height)/float64(h))), o.Height
+	}
+
+	if o.MaxSize > 0 && max(outW, outH) > o.MaxSize {
+		scale := float64(o.MaxSize) / float64(max(outW, outH))
+		outW = int(math.Round(float64(outW) * scale))
+		outH = int(math.Round(float64(outH) * scale))
+	}
+	return max(outW, 1), max(outH, 1)
+}
+
+// PrepareImage crops and resizes img by opts, before edges are found.
+func PrepareImage(img image.Image, opts ResizeOptions) image.Image {
+	bounds := img.Bounds()
+
+	if !opts.Crop.Empty() {
+		crop := opts.Crop.Add(bounds.Min)
+		if !crop.In(bounds) {
+			fmt.Printf("Crop %v is outside the %vx%v image; cropping to the part inside\n",
+				opts.Crop, bounds.Dx(), bounds.Dy())
+			crop = crop.Intersect(bounds)
+		}
+		if crop.Empty() {
+			fmt.Print("Crop misses the image entirely; leaving it whole\n")
+		} else {
+			bounds = crop
+		}
+	}
+
+	if opts.Trim {
+		fmt.Print("Trimming uniform borders...")
+		bounds = TrimBounds(cropImage(img, bounds))
+		fmt.Printf(" Done, %vx%v\n", bounds.Dx(), bounds.Dy())
+	}
+	if bounds != img.Bounds() {
+		img = cropImage(img, bounds)
+	}
+
+	w, h := opts.Size(bounds.Dx(), bounds.Dy())
+	if w != bounds.Dx() || h != bounds.Dy() {
+		fmt.Printf("Resizing from %vx%v to %vx%v...", bounds.Dx(), bounds.Dy(), w, h)
+		img = Resize(img, w, h, opts.Filter)
+		fmt.Print(" Done\n")
+	}
+	return img
+}
+
+// cropImage returns the part r of img, sharing its pixels where it can.
+func cropImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+	out := image.NewRGBA(r)
+	draw.Draw(out, r, img, r.Min, draw.Src)
+	return out
+}
+
+// A resampleFilter weights source pixels by their distance from the centre of
+// an output pixel, out to support, in source pixels when enlarging, or output
+// pixels when shrinking.
+type resampleFilter struct {
+	support float64
+	kernel  func(x float64) float64
+}
+
+var resampleFilters = map[string]resampleFilter{
+	// Lanczos with 3 lobes: sharp, with little ringing at edges
+	"lanczos": {3, func(x float64) float64 {
+		if x == 0 {
+			return 1
+		}
+		if math.Abs(x) >= 3 {
+			return 0
+		}
+		px := math.Pi * x
+		return 3 * math.Sin(px) * math.Sin(px/3) / (px * px)
+	}},
+	// Catmull-Rom bicubic
+	"bicubic": {2, func(x float64) float64 {
+		x = math.Abs(x)
+		switch {
+		case x < 1:
+			return 1.5*x*x*x - 2.5*x*x + 1
+		case x < 2:
+			return -0.5*x*x*x + 2.5*x*x - 4*x + 2
+		}
+		return 0
+	}},
+	// Box, which averages the area under each output pixel when shrinking
+	"box": {0.5, func(x float64) float64 {
+		if x >= -0.5 && x < 0.5 {
+			return 1
+		}
+		return 0
+	}},
+}
+
+// resampleWeights holds the source pixels, from start, and their weights
+// which make up one output pixel.
+type resampleWeights struct {
+	start   int
+	weights []float64
+}
+
+// weights returns the weights resampling a row of src pixels to dst pixels.
+func (f resampleFilter) weights(src, dst int) []resampleWeights {
+	scale := float64(src) / float64(dst)
+	// Widen the filter when shrinking, so every source pixel counts
+	filterScale := max(scale, 1)
+	support := f.support * filterScale
+
+	out := make([]resampleWeights, dst)
+	for i := range out {
+		centre := (float64(i) + 0.5) * scale
+		lo := max(int(math.Floor(centre-support)), 0)
+		hi := min(int(math.Ceil(centre+support)), src)
+
+		w := resampleWeights{start: lo, weights: make([]float64, hi-lo)}
+		sum := 0.0
+		for j := lo; j < hi; j++ {
+			v := f.kernel((float64(j) + 0.5 - centre) / filterScale)
+			w.weights[j-lo] = v
+			sum += v
+		}
+		if sum == 0 {
+			// Too narrow to reach a pixel centre: take the nearest pixel
+			w = resampleWeights{start: min(int(centre), src-1), weights: []float64{1}}
+		} else {
+			for j := range w.weights {
+				w.weights[j] /= sum
+			}
+		}
+		out[i] = w
+	}
+	return out
+}
+
+// Resize resamples img to width by height pixels with the named filter, one
+// of ResampleFilters, first across and then down.
+func Resize(img image.Image, width, height int, filter string) *image.RGBA {
+	f, ok := resampleFilters[filter]
+	if !ok {
+		f = resampleFilters["lanczos"]
+	}
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// Resample premultiplied colours, so transparent pixels don't bleed
+	// their colour into their neighbours
+	src := image.NewRGBA(image.Rect(0, 0, srcW, srcH))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	across := f.weights(srcW, width)
+	tmp := make([]float64, srcH*width*4)
+	for y := 0; y < srcH; y++ {
+		row := src.Pix[y*src.Stride:]
+		for x, w := range across {
+			out := tmp[(y*width+x)*4:]
+			for k, v := range w.weights {
+				p := row[(w.start+k)*4:]
+				for c := 0; c < 4; c++ {
+					out[c] += v * float64(p[c])
+				}
+			}
+		}
+	}
+
+	down := f.weights(srcH, height)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, w := range down {
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for k, v := range w.weights {
+				p := tmp[((w.start+k)*width+x)*4:]
+				for c := 0; c < 4; c++ {
+					sum[c] += v * p[c]
+				}
+			}
+
+			// Lanczos and bicubic overshoot at edges, so clamp, keeping
+			// colours no brighter than their alpha allows
+			alpha := math.Round(min(max(sum[3], 0), 255))
+			p := dst.Pix[y*dst.Stride+x*4:]
+			for c := 0; c < 3; c++ {
+				p[c] = uint8(math.Round(min(max(sum[c], 0), alpha)))
+			}
+			p[3] = uint8(alpha)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,132 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestParseCrop(t *testing.T) {
+	got, err := ParseCrop("10, 20,30,40")
+	if err != nil {
+		t.Fatalf("Parsing failed: %v\n", err)
+	}
+	if want := image.Rect(10, 20, 40, 60); got != want {
+		t.Errorf("Got %v, expected %v\n", got, want)
+	}
+
+	for _, s := range []string{"", "1,2,3", "1,2,3,x", "-1,0,5,5", "0,0,0,5"} {
+		if _, err := ParseCrop(s); err == nil {
+			t.Errorf("Expected an error parsing %q\n", s)
+		}
+	}
+}
+
+func TestResizeSize(t *testing.T) {
+	tests := []struct {
+		opts ResizeOptions
+		w, h int
+	}{
+		{ResizeOptions{}, 400, 300},
+		{ResizeOptions{Width: 200}, 200, 150},
+		{ResizeOptions{Height: 600}, 800, 600},
+		{ResizeOptions{Width: 100, Height: 100}, 100, 100},
+		{ResizeOptions{MaxSize: 100}, 100, 75},
+		{ResizeOptions{MaxSize: 1000}, 400, 300},
+		{ResizeOptions{Width: 800, MaxSize: 400}, 400, 300},
+	}
+	for _, test := range tests {
+		w, h := test.opts.Size(400, 300)
+		if w != test.w || h != test.h {
+			t.Errorf("Size with %+v is %vx%v, expected %vx%v\n", test.opts, w, h, test.w, test.h)
+		}
+	}
+}
+
+func TestTrimBounds(t *testing.T) {
+	// A white image with a gray square, and some faint noise in the border
+	img := image.NewRGBA(image.Rect(0, 0, 20, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 20; x++ {
+			img.Set(x, y, color.White)
+		}
+	}
+	img.Set(1, 18, color.RGBA{250, 250, 250, 255})
+	for y := 5; y < 12; y++ {
+		for x := 3; x < 15; x++ {
+			img.Set(x, y, color.Gray{100})
+		}
+	}
+
+	if got, want := TrimBounds(img), image.Rect(3, 5, 15, 12); got != want {
+		t.Errorf("Trimmed to %v, expected %v\n", got, want)
+	}
+
+	blank := image.NewGray(image.Rect(0, 0, 5, 5))
+	if got := TrimBounds(blank); got != blank.Bounds() {
+		t.Errorf("Trimmed a blank image to %v, expected it whole\n", got)
+	}
+}
+
+func TestResize(t *testing.T) {
+	// Black on the left half and white on the right
+	img := image.NewGray(image.Rect(0, 0, 64, 32))
+	for y := 0; y < 32; y++ {
+		for x := 32; x < 64; x++ {
+			img.SetGray(x, y, color.Gray{255})
+		}
+	}
+
+	for _, filter := range ResampleFilters {
+		for _, size := range []image.Point{{16, 8}, {128, 64}} {
+			out := Resize(img, size.X, size.Y, filter)
+			if out.Bounds().Size() != size {
+				t.Fatalf("%v resized to %v, expected %v\n", filter, out.Bounds().Size(), size)
+			}
+			// Far from the edge, the halves keep their colours
+			left := out.RGBAAt(1, size.Y/2)
+			right := out.RGBAAt(size.X-2, size.Y/2)
+			if left != (color.RGBA{0, 0, 0, 255}) || right != (color.RGBA{255, 255, 255, 255}) {
+				t.Errorf("%v resized to %v has halves %v and %v\n", filter, size, left, right)
+			}
+		}
+	}
+
+	// Shrinking by box averages each block
+	checks := image.NewGray(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			if (x+y)%2 == 0 {
+				checks.SetGray(x, y, color.Gray{200})
+			}
+		}
+	}
+	out := Resize(checks, 2, 2, "box")
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 2; x++ {
+			if got := out.RGBAAt(x, y).R; got != 100 {
+				t.Errorf("Box average at (%d, %d) is %d, expected 100\n", x, y, got)
+			}
+		}
+	}
+}
+
+func TestPrepareImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 100, 80))
+	out := PrepareImage(img, ResizeOptions{Crop: image.Rect(10, 10, 60, 50), MaxSize: 25, Filter: "lanczos"})
+	if got := out.Bounds().Size(); got != (image.Point{25, 20}) {
+		t.Errorf("Prepared image is %v, expected 25x20\n", got)
+	}
+
+	// A cropped image keeps its pixels through the pipeline
+	img.Set(10, 10, color.Black)
+	out = PrepareImage(img, ResizeOptions{Crop: image.Rect(10, 10, 60, 50), Filter: "lanczos"})
+	gray := GrayscaleImage(out)
+	if got := gray.Bounds().Size(); got != (image.Point{50, 40}) {
+		t.Errorf("Grayscale of cropped image is %v, expected 50x40\n", got)
+	}
+	if gray.GrayAt(0, 0).Y != 0 || gray.GrayAt(1, 0).Y != 255 {
+		t.Errorf("Grayscale of cropped image starts %v, %v, expected black then white\n",
+			gray.GrayAt(0, 0), gray.GrayAt(1, 0))
+	}
+}
@@ -0,0 +1,114 @@
+package cic
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"slices"
+)
+
+// Multi-scale edge detection. Edges of important outlines are found whatever
+// the blur, while those of texture and fine detail vanish as it increases.
+// Edges are found at each of several standard deviations of blur, and those
+// found at the finest scale are kept only if they can be tracked through
+// enough of the coarser ones, keeping the sharp placement of the finest scale
+// with the robustness of the coarser.
+
+// ValidateScales checks that the scales and the number of them an edge must
+// persist over, minScales, make sense.
+func ValidateScales(scales []float64, minScales int) error {
+	for _, s := range scales {
+		if s < 0 {
+			return fmt.Errorf("scales can't be negative (got %v)", s)
+		}
+	}
+	if len(scales) > 1 && (minScales < 1 || minScales > len(scales)) {
+		return fmt.Errorf("edges must persist over between 1 and %d scales (got %d)", len(scales), minScales)
+	}
+	return nil
+}
+
+// ScaleSpaceEdges finds edges in img, as the blur, Sobel filter, non-max
+// suppression and threshold suppression stages of the pipeline do, at each
+// of opts.Scales, keeping those found at the finest scale which persist over
+// at least opts.MinScales of them.
+func ScaleSpaceEdges(img *image.Gray, opts ColouringOptions) *ImageGradients {
+	scales := slices.Clone(opts.Scales)
+	slices.Sort(scales)
+
+	// Each scale is blurred on from the last: blurring by the discrete
+	// Gaussian of variance t and then u is the same as by that of t + u
+	blurred := image.NewGray(img.Bounds())
+	copy(blurred.Pix, img.Pix)
+	levels := make([]*ImageGradients, len(scales))
+	variance := 0.0
+	for k, sigma := range scales {
+		if step := sigma*sigma - variance; step > 0 {
+			fmt.Printf("Applying Gaussian blur for scale σ = %v...", sigma)
+			blurred = GaussianBlur(blurred, math.Sqrt(step))
+			fmt.Print(" Done\n")
+			variance = sigma * sigma
+		}
+
+		fmt.Printf("Finding edges at scale σ = %v...", sigma)
+		ig := SobelFilter(blurred)
+		ig = ig.NonmaxSuppression(opts.NonMaxSuppressionDistance)
+		ig = ig.LineFollowingThresholdSuppression(opts.UpperThreshold, opts.LowerThreshold)
+		fmt.Print(" Done\n")
+		levels[k] = ig
+	}
+
+	fmt.Printf("Keeping edges which persist over %v of %v scales...", opts.MinScales, len(scales))
+	persistence := EdgePersistence(levels, scales)
+	finest := levels[0]
+	for j := 0; j < finest.Y; j++ {
+		for i := 0; i < finest.X; i++ {
+			if persistence[j][i] < opts.MinScales {
+				finest.Value[j][i] = 0
+			}
+		}
+	}
+	fmt.Print(" Done\n")
+	return finest
+}
+
+// EdgePersistence tracks the edges of levels, found at increasing scales,
+// returning for each pixel of the finest level the number of scales its edge
+// can be followed through, or 0 if it isn't an edge. Blurring moves edges, so
+// an edge is followed from one scale to the next if the next has an edge
+// within the difference between their standard deviations, and at least a
+// pixel.
+func EdgePersistence(levels []*ImageGradients, scales []float64) [][]int {
+	var next [][]int
+	for k := len(levels) - 1; k >= 0; k-- {
+		ig := levels[k]
+		radius := 0
+		if next != nil {
+			radius = max(1, int(math.Ceil(scales[k+1]-scales[k])))
+		}
+
+		count := make([][]int, ig.Y)
+		for j := 0; j < ig.Y; j++ {
+			count[j] = make([]int, ig.X)
+			for i := 0; i < ig.X; i++ {
+				if ig.Value[j][i] == 0 {
+					continue
+				}
+				count[j][i] = 1
+				if next == nil {
+					continue
+				}
+				// Follow the longest track of the next scale's edges nearby
+				best := 0
+				for n := max(j-radius, 0); n <= min(j+radius, ig.Y-1); n++ {
+					for m := max(i-radius, 0); m <= min(i+radius, ig.X-1); m++ {
+						best = max(best, next[n][m])
+					}
+				}
+				count[j][i] += best
+			}
+		}
+		next = count
+	}
+	return next
+}
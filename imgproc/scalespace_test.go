@@ -0,0 +1,105 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestEdgePersistence(t *testing.T) {
+	// Two edges at the finest scale, only one of which can be followed,
+	// drifting, through the coarser scales
+	levels := make([]*ImageGradients, 3)
+	for k := range levels {
+		levels[k] = CreateImageGradients(9, 7)
+	}
+	levels[0].Value[3][1] = 255
+	levels[0].Value[3][6] = 255
+	levels[1].Value[3][2] = 255
+	levels[2].Value[3][4] = 255
+
+	got := EdgePersistence(levels, []float64{1, 2, 4})
+	for _, test := range []struct {
+		x, y, want int
+	}{
+		{1, 3, 3},
+		{6, 3, 1},
+		{0, 0, 0},
+	} {
+		if got[test.y][test.x] != test.want {
+			t.Errorf("Persistence at (%d, %d) is %d, expected %d\n",
+				test.x, test.y, got[test.y][test.x], test.want)
+		}
+	}
+}
+
+func TestScaleSpaceEdges(t *testing.T) {
+	// A dark square on white, beside a patch of fine, faint checks
+	img := image.NewGray(image.Rect(0, 0, 96, 64))
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 96; x++ {
+			v := uint8(255)
+			switch {
+			case x >= 10 && x < 40 && y >= 16 && y < 48:
+				v = 40
+			case x >= 56 && x < 88 && y >= 16 && y < 48 && (x/3+y/3)%2 == 0:
+				v = 195
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+
+	edgesIn := func(ig *ImageGradients, r image.Rectangle) int {
+		n := 0
+		for j := r.Min.Y; j < r.Max.Y; j++ {
+			for i := r.Min.X; i < r.Max.X; i++ {
+				if ig.Value[j][i] > 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	square := image.Rect(5, 11, 45, 53)
+	texture := image.Rect(59, 19, 85, 45)
+
+	opts := DefaultColouringOptions()
+	single := SobelFilter(GaussianBlur(GrayscaleImage(img), opts.Sigma)).
+		NonmaxSuppression(opts.NonMaxSuppressionDistance).
+		LineFollowingThresholdSuppression(opts.UpperThreshold, opts.LowerThreshold)
+	if edgesIn(single, texture) == 0 {
+		t.Fatal("Expected a single scale to find edges in the texture\n")
+	}
+
+	opts.Scales = []float64{4, 1, 2}
+	opts.MinScales = 3
+	multi := ScaleSpaceEdges(GrayscaleImage(img), opts)
+	if n := edgesIn(multi, texture); n != 0 {
+		t.Errorf("Found %d edge pixels in the texture, expected none\n", n)
+	}
+	// The square's outline, 2 * (30 + 32) pixels round, is kept
+	if n := edgesIn(multi, square); n < 100 {
+		t.Errorf("Found %d edge pixels round the square, expected its outline\n", n)
+	}
+
+	// The thresholds apply at every scale
+	opts.UpperThreshold, opts.LowerThreshold = 1000, 1000
+	if n := edgesIn(ScaleSpaceEdges(GrayscaleImage(img), opts), img.Bounds()); n != 0 {
+		t.Errorf("Found %d edge pixels above every gradient, expected none\n", n)
+	}
+}
+
+func TestValidateScales(t *testing.T) {
+	if err := ValidateScales([]float64{1, 2, 4}, 2); err != nil {
+		t.Errorf("Expected valid scales, got %v\n", err)
+	}
+	if err := ValidateScales(nil, 2); err != nil {
+		t.Errorf("Expected no scales to be valid, got %v\n", err)
+	}
+	if err := ValidateScales([]float64{1, 2}, 3); err == nil {
+		t.Error("Expected an error persisting over more scales than given\n")
+	}
+	if err := ValidateScales([]float64{-1, 2}, 1); err == nil {
+		t.Error("Expected an error for a negative scale\n")
+	}
+}
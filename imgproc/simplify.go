@@ -0,0 +1,209 @@
+package cic
+
+import (
+	"container/heap"
+	"math"
+)
+
+// Vec2 is a point or direction in the plane.
+type Vec2 struct {
+	X, Y float64
+}
+
+func (v Vec2) Add(w Vec2) Vec2      { return Vec2{v.X + w.X, v.Y + w.Y} }
+func (v Vec2) Sub(w Vec2) Vec2      { return Vec2{v.X - w.X, v.Y - w.Y} }
+func (v Vec2) Scale(s float64) Vec2 { return Vec2{v.X * s, v.Y * s} }
+func (v Vec2) Dot(w Vec2) float64   { return v.X*w.X + v.Y*w.Y }
+func (v Vec2) Cross(w Vec2) float64 { return v.X*w.Y - v.Y*w.X }
+func (v Vec2) Len() float64         { return math.Hypot(v.X, v.Y) }
+func (v Vec2) Dist(w Vec2) float64  { return v.Sub(w).Len() }
+func (v Vec2) Normalise() Vec2 {
+	if l := v.Len(); l > 0 {
+		return v.Scale(1 / l)
+	}
+	return v
+}
+
+// Pos returns the position of a contour point.
+func (p ContourPoint) Pos() Vec2 {
+	return Vec2{p.X, p.Y}
+}
+
+// segmentDist returns the distance from p to the line segment from a to b.
+func segmentDist(p, a, b Vec2) float64 {
+	ab := b.Sub(a)
+	l2 := ab.Dot(ab)
+	if l2 == 0 {
+		return p.Dist(a)
+	}
+	t := min(max(p.Sub(a).Dot(ab)/l2, 0), 1)
+	return p.Dist(a.Add(ab.Scale(t)))
+}
+
+// rdp marks which points between first and last to keep, by the
+// Ramer-Douglas-Peucker algorithm.
+func rdp(pts []ContourPoint, first, last int, tolerance float64, keep []bool) {
+	if last-first < 2 {
+		return
+	}
+	farthest, farthestDist := -1, tolerance
+	for i := first + 1; i < last; i++ {
+		if d := segmentDist(pts[i].Pos(), pts[first].Pos(), pts[last].Pos()); d > farthestDist {
+			farthest, farthestDist = i, d
+		}
+	}
+	if farthest < 0 {
+		return
+	}
+	keep[farthest] = true
+	rdp(pts, first, farthest, tolerance, keep)
+	rdp(pts, farthest, last, tolerance, keep)
+}
+
+// SimplifyRDP simplifies a contour with the Ramer-Douglas-Peucker algorithm,
+// keeping the fewest points such that no removed point lies more than
+// tolerance pixels from the simplified line. A closed contour is split in two
+// at its first point and the point farthest from it.
+func SimplifyRDP(c Contour, tolerance float64) Contour {
+	pts := c.Points
+	n := len(pts)
+	if n < 3 {
+		return c
+	}
+
+	keep := make([]bool, n)
+	keep[0] = true
+	if c.Closed {
+		far := 0
+		for i := range pts {
+			if pts[i].Pos().Dist(pts[0].Pos()) > pts[far].Pos().Dist(pts[0].Pos()) {
+				far = i
+			}
+		}
+		keep[far] = true
+		rdp(pts, 0, far, tolerance, keep)
+
+		// The second half runs from the far point back round to the start
+		loop := append(append([]ContourPoint(nil), pts[far:]...), pts[0])
+		loopKeep := make([]bool, len(loop))
+		rdp(loop, 0, len(loop)-1, tolerance, loopKeep)
+		for i, k := range loopKeep {
+			if k {
+				keep[far+i] = true
+			}
+		}
+	} else {
+		keep[n-1] = true
+		rdp(pts, 0, n-1, tolerance, keep)
+	}
+
+	out := Contour{Closed: c.Closed}
+	for i, k := range keep {
+		if k {
+			out.Points = append(out.Points, pts[i])
+		}
+	}
+	return out
+}
+
+// vwPoint is a point in Visvalingam-Whyatt simplification, linked to its
+// remaining neighbours.
+type vwPoint struct {
+	idx        int
+	prev, next *vwPoint
+	area       float64
+	heapIdx    int
+}
+
+type vwHeap []*vwPoint
+
+func (h vwHeap) Len() int           { return len(h) }
+func (h vwHeap) Less(i, j int) bool { return h[i].area < h[j].area }
+func (h vwHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].heapIdx, h[j].heapIdx = i, j
+}
+func (h *vwHeap) Push(x any) {
+	p := x.(*vwPoint)
+	p.heapIdx = len(*h)
+	*h = append(*h, p)
+}
+func (h *vwHeap) Pop() any {
+	old := *h
+	p := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return p
+}
+
+// SimplifyVisvalingam simplifies a contour with the Visvalingam-Whyatt
+// algorithm, repeatedly removing the point which forms the smallest triangle
+// with its neighbours, until every remaining triangle has an area of at least
+// tolerance² square pixels. It tends to keep the overall shape of gentle
+// curves better than SimplifyRDP.
+func SimplifyVisvalingam(c Contour, tolerance float64) Contour {
+	pts := c.Points
+	n := len(pts)
+	minPoints := 2
+	if c.Closed {
+		minPoints = 3
+	}
+	if n <= minPoints {
+		return c
+	}
+
+	nodes := make([]*vwPoint, n)
+	for i := range nodes {
+		nodes[i] = &vwPoint{idx: i}
+	}
+	for i, p := range nodes {
+		if c.Closed || i > 0 {
+			p.prev = nodes[(i+n-1)%n]
+		}
+		if c.Closed || i < n-1 {
+			p.next = nodes[(i+1)%n]
+		}
+	}
+
+	area := func(p *vwPoint) float64 {
+		if p.prev == nil || p.next == nil {
+			return math.Inf(1)
+		}
+		a, b, q := pts[p.prev.idx].Pos(), pts[p.next.idx].Pos(), pts[p.idx].Pos()
+		return math.Abs(b.Sub(a).Cross(q.Sub(a))) / 2
+	}
+
+	h := make(vwHeap, 0, n)
+	for _, p := range nodes {
+		p.area = area(p)
+		heap.Push(&h, p)
+	}
+
+	threshold := tolerance * tolerance
+	remaining := n
+	removed := make([]bool, n)
+	for remaining > minPoints {
+		p := h[0]
+		if p.area >= threshold {
+			break
+		}
+		heap.Pop(&h)
+		removed[p.idx] = true
+		remaining--
+
+		p.prev.next, p.next.prev = p.next, p.prev
+		// A neighbour's area never drops below that of the point just
+		// removed, so that points are removed in order of significance
+		for _, q := range []*vwPoint{p.prev, p.next} {
+			q.area = max(area(q), p.area)
+			heap.Fix(&h, q.heapIdx)
+		}
+	}
+
+	out := Contour{Closed: c.Closed}
+	for i, r := range removed {
+		if !r {
+			out.Points = append(out.Points, pts[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,54 @@
+package cic
+
+import "testing"
+
+func TestSimplifyRDP(t *testing.T) {
+	// A line along y = 0 wobbling by half a pixel
+	var line Contour
+	for x := 0; x <= 20; x++ {
+		line.Points = append(line.Points, ContourPoint{float64(x), float64(x%2) / 2, 1})
+	}
+	if n := len(SimplifyRDP(line, 1).Points); n != 2 {
+		t.Fatalf("Noisy straight line simplified to %d points, expected 2\n", n)
+	}
+
+	// The outline of a square, traced pixel by pixel
+	var square Contour
+	square.Closed = true
+	for _, side := range [][4]int{{0, 0, 1, 0}, {10, 0, 0, 1}, {10, 10, -1, 0}, {0, 10, 0, -1}} {
+		for i := 0; i < 10; i++ {
+			square.Points = append(square.Points, ContourPoint{float64(side[0] + i*side[2]), float64(side[1] + i*side[3]), 1})
+		}
+	}
+	simplified := SimplifyRDP(square, 1)
+	if len(simplified.Points) != 4 || !simplified.Closed {
+		t.Fatalf("Square simplified to %v, expected its 4 corners\n", simplified)
+	}
+	for _, p := range simplified.Points {
+		if (p.X != 0 && p.X != 10) || (p.Y != 0 && p.Y != 10) {
+			t.Fatalf("Square simplified to %v, expected its 4 corners\n", simplified)
+		}
+	}
+}
+
+func TestSimplifyVisvalingam(t *testing.T) {
+	// An L shape, which should keep its ends and its corner
+	var l Contour
+	for y := 10; y > 0; y-- {
+		l.Points = append(l.Points, ContourPoint{0, float64(y), 1})
+	}
+	for x := 0; x <= 10; x++ {
+		l.Points = append(l.Points, ContourPoint{float64(x), 0, 1})
+	}
+
+	simplified := SimplifyVisvalingam(l, 1)
+	expected := []Vec2{{0, 10}, {0, 0}, {10, 0}}
+	if len(simplified.Points) != len(expected) {
+		t.Fatalf("L shape simplified to %v, expected %v\n", simplified.Points, expected)
+	}
+	for i, p := range simplified.Points {
+		if p.Pos() != expected[i] {
+			t.Fatalf("L shape simplified to %v, expected %v\n", simplified.Points, expected)
+		}
+	}
+}
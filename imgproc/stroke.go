@@ -0,0 +1,80 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// StrokeLines draws the edges of edgeImg, which are light on a black
+// background, as anti-aliased black lines on white. Each edge pixel is stamped
+// with a round brush whose width, in pixels, runs from minWidth for the
+// weakest edge to maxWidth for the strongest, so that line weight follows edge
+// strength smoothly rather than stepping between fixed thicknesses.
+func StrokeLines(edgeImg *image.Gray, minWidth, maxWidth float64) *image.Gray {
+	bounds := edgeImg.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	strength := func(x, y int) uint8 {
+		return edgeImg.GrayAt(bounds.Min.X+x, bounds.Min.Y+y).Y
+	}
+
+	lo, hi := uint8(255), uint8(0)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if v := strength(x, y); v > 0 {
+				lo, hi = min(lo, v), max(hi, v)
+			}
+		}
+	}
+
+	// Ink coverage of each pixel, from 0 (white) to 1 (black)
+	coverage := make([]float64, width*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if strength(x, y) == 0 {
+				continue
+			}
+
+			// Average strength with neighbouring edge pixels, so that width
+			// changes gradually along a line
+			sum, n := 0.0, 0
+			for j := y - 1; j <= y+1; j++ {
+				for i := x - 1; i <= x+1; i++ {
+					if i >= 0 && i < width && j >= 0 && j < height && strength(i, j) > 0 {
+						sum += float64(strength(i, j))
+						n++
+					}
+				}
+			}
+			t := 1.0
+			if hi > lo {
+				t = (sum/float64(n) - float64(lo)) / float64(hi-lo)
+			}
+			radius := (minWidth + t*(maxWidth-minWidth)) / 2
+
+			// A pixel is covered in proportion to how far the brush's edge
+			// passes its centre, up to half a pixel either side
+			reach := int(math.Ceil(radius + 0.5))
+			for j := max(y-reach, 0); j <= min(y+reach, height-1); j++ {
+				for i := max(x-reach, 0); i <= min(x+reach, width-1); i++ {
+					d := math.Hypot(float64(i-x), float64(j-y))
+					c := min(max(radius+0.5-d, 0), 1)
+					if idx := j*width + i; c > coverage[idx] {
+						coverage[idx] = c
+					}
+				}
+			}
+		}
+	}
+
+	dst := image.NewGray(bounds)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			dst.SetGray(bounds.Min.X+x, bounds.Min.Y+y, color.Gray{clampUint8(255 * (1 - coverage[y*width+x]))})
+		}
+	}
+
+	return dst
+}
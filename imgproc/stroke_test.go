@@ -0,0 +1,38 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestStrokeLines(t *testing.T) {
+	// A weak edge pixel and a strong one
+	edges := image.NewGray(image.Rect(0, 0, 30, 20))
+	edges.SetGray(5, 10, color.Gray{64})
+	edges.SetGray(20, 10, color.Gray{255})
+
+	sheet := StrokeLines(edges, 1, 8)
+
+	if sheet.GrayAt(5, 10).Y != 0 || sheet.GrayAt(20, 10).Y != 0 {
+		t.Fatalf("Edge pixels are not black after stroking\n")
+	}
+	if sheet.GrayAt(6, 10).Y != 255 {
+		t.Fatalf("Weak edge was stroked wider than 1 pixel\n")
+	}
+	for x := 17; x <= 23; x++ {
+		if sheet.GrayAt(x, 10).Y != 0 {
+			t.Fatalf("Pixel (%v, 10) within strong edge's 8 pixel brush is %v, expected black\n",
+				x, sheet.GrayAt(x, 10).Y)
+		}
+	}
+	if sheet.GrayAt(25, 10).Y != 255 {
+		t.Fatalf("Strong edge was stroked wider than 8 pixels\n")
+	}
+
+	// The brush's boundary falls between pixel centres on the diagonal, so
+	// should be partly covered
+	if c := sheet.GrayAt(23, 13).Y; c == 0 || c == 255 {
+		t.Fatalf("Pixel on brush boundary is %v, expected an anti-aliased gray\n", c)
+	}
+}
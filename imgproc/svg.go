@@ -0,0 +1,153 @@
+package cic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// SVGOptions controls how contours are written as an SVG image.
+type SVGOptions struct {
+	// Width and Height are the dimensions of the traced image, which become
+	// the SVG's viewBox.
+	Width, Height int
+	// MinWidth and MaxWidth are the stroke widths of the weakest and
+	// strongest contours.
+	MinWidth, MaxWidth float64
+	// Paths controls how contours are simplified and fitted with curves.
+	Paths PathOptions
+	// Background fills the image with white behind the lines.
+	Background bool
+}
+
+// svgNum formats a coordinate with at most two decimal places.
+func svgNum(v float64) string {
+	return formatNum(v, 2)
+}
+
+// formatNum formats v with at most the given number of decimal places, and
+// no exponent.
+func formatNum(v float64, places int) string {
+	s := strconv.FormatFloat(v, 'f', places, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		return "0"
+	}
+	return s
+}
+
+// dropCollinear removes the points of a contour which lie on a straight line
+// between their neighbours, such as the middle of a horizontal run of pixels.
+func dropCollinear(c Contour) Contour {
+	n := len(c.Points)
+	if n < 3 {
+		return c
+	}
+
+	keep := func(i int) bool {
+		if !c.Closed && (i == 0 || i == n-1) {
+			return true
+		}
+		a, b, p := c.Points[(i+n-1)%n], c.Points[(i+1)%n], c.Points[i]
+		return (p.X-a.X)*(b.Y-a.Y) != (p.Y-a.Y)*(b.X-a.X)
+	}
+
+	out := Contour{Closed: c.Closed}
+	for i := range c.Points {
+		if keep(i) {
+			out.Points = append(out.Points, c.Points[i])
+		}
+	}
+	if len(out.Points) < 2 {
+		return c
+	}
+	return out
+}
+
+// svgPathData returns the path data drawing p.
+func svgPathData(p Path) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "M%s %s", svgNum(p.Start.X), svgNum(p.Start.Y))
+
+	// The straight segment closing a loop is left to Z
+	for _, seg := range p.Segments {
+		if seg.Curve {
+			fmt.Fprintf(&sb, "C%s %s %s %s %s %s",
+				svgNum(seg.C1.X), svgNum(seg.C1.Y),
+				svgNum(seg.C2.X), svgNum(seg.C2.Y),
+				svgNum(seg.End.X), svgNum(seg.End.Y))
+		} else {
+			fmt.Fprintf(&sb, "L%s %s", svgNum(seg.End.X), svgNum(seg.End.Y))
+		}
+	}
+
+	if p.Closed {
+		sb.WriteString("Z")
+	}
+	return sb.String()
+}
+
+// meanStrength returns the average strength of the points of c.
+func meanStrength(c Contour) float64 {
+	sum := 0.0
+	for _, p := range c.Points {
+		sum += p.Strength
+	}
+	return sum / float64(len(c.Points))
+}
+
+// StrokePaths converts contours to paths with ContourPath, returning them
+// with the width to stroke each: from minWidth for the weakest contour to
+// maxWidth for the strongest, by the average strength of its points before
+// simplification.
+func StrokePaths(contours []Contour, minWidth, maxWidth float64, opts PathOptions) ([]Path, []float64) {
+	strengths := make([]float64, len(contours))
+	lo, hi := 1.0, 0.0
+	for i, c := range contours {
+		strengths[i] = meanStrength(c)
+		lo, hi = min(lo, strengths[i]), max(hi, strengths[i])
+	}
+
+	paths := make([]Path, len(contours))
+	widths := make([]float64, len(contours))
+	for i, c := range contours {
+		paths[i] = ContourPath(c, opts)
+		if hi <= lo {
+			widths[i] = maxWidth
+		} else {
+			widths[i] = minWidth + (strengths[i]-lo)/(hi-lo)*(maxWidth-minWidth)
+		}
+		widths[i] = min(max(widths[i], min(minWidth, maxWidth)), max(minWidth, maxWidth))
+	}
+	return paths, widths
+}
+
+// WriteSVG writes contours as black lines in an SVG image, stroked with a
+// round pen with widths given by StrokePaths. Single points are drawn as
+// dots.
+func WriteSVG(w io.Writer, contours []Contour, opts SVGOptions) error {
+	bw := bufio.NewWriter(w)
+	paths, widths := StrokePaths(contours, opts.MinWidth, opts.MaxWidth, opts.Paths)
+
+	fmt.Fprintf(bw, `<?xml version="1.0" encoding="UTF-8"?>`+"\n")
+	fmt.Fprintf(bw, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n",
+		opts.Width, opts.Height, opts.Width, opts.Height)
+	if opts.Background {
+		fmt.Fprintf(bw, `<rect width="100%%" height="100%%" fill="white"/>`+"\n")
+	}
+	fmt.Fprintf(bw, `<g fill="none" stroke="black" stroke-linecap="round" stroke-linejoin="round">`+"\n")
+
+	for i, p := range paths {
+		if len(p.Segments) == 0 {
+			fmt.Fprintf(bw, `<circle cx="%s" cy="%s" r="%s" fill="black" stroke="none"/>`+"\n",
+				svgNum(p.Start.X), svgNum(p.Start.Y), svgNum(widths[i]/2))
+			continue
+		}
+		fmt.Fprintf(bw, `<path stroke-width="%s" d="%s"/>`+"\n", svgNum(widths[i]), svgPathData(p))
+	}
+
+	fmt.Fprintf(bw, "</g>\n</svg>\n")
+	return bw.Flush()
+}
@@ -0,0 +1,84 @@
+package cic
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+	contours := []Contour{
+		// A horizontal run of pixels, which should be drawn as one segment
+		{Points: []ContourPoint{{0.5, 0.5, 0.2}, {1.5, 0.5, 0.2}, {2.5, 0.5, 0.2}, {3.5, 0.5, 0.2}}},
+		{Points: []ContourPoint{{5.5, 5.5, 1}, {6.5, 5.5, 1}, {6.5, 6.5, 1}}, Closed: true},
+		{Points: []ContourPoint{{9.5, 9.5, 0.6}}},
+	}
+
+	var buf bytes.Buffer
+	err := WriteSVG(&buf, contours, SVGOptions{
+		Width: 20, Height: 10, MinWidth: 1, MaxWidth: 3, Background: true,
+	})
+	if err != nil {
+		t.Fatalf("Writing SVG failed: %v\n", err)
+	}
+	svg := buf.String()
+
+	for _, expected := range []string{
+		`viewBox="0 0 20 10"`,
+		`<rect width="100%" height="100%" fill="white"/>`,
+		`<path stroke-width="1" d="M0.5 0.5L3.5 0.5"/>`,
+		`<path stroke-width="3" d="M5.5 5.5L6.5 5.5L6.5 6.5Z"/>`,
+		`<circle cx="9.5" cy="9.5" r="1"`,
+	} {
+		if !strings.Contains(svg, expected) {
+			t.Fatalf("SVG output does not contain %s:\n%s", expected, svg)
+		}
+	}
+}
+
+func TestStrokePathsSimplified(t *testing.T) {
+	// Straight lines whose strength varies along them, so that simplifying
+	// them to their ends changes their average strength
+	line := func(strengths ...float64) Contour {
+		var c Contour
+		for i, s := range strengths {
+			c.Points = append(c.Points, ContourPoint{float64(i) + 0.5, 0.5, s})
+		}
+		return c
+	}
+	contours := []Contour{
+		line(1, 0.1, 0.1, 0.1, 1),
+		line(0.2, 0.9, 0.9, 0.9, 0.2),
+		line(0.5, 0.5, 0.5, 0.5, 0.5),
+	}
+
+	paths, widths := StrokePaths(contours, 1, 4, PathOptions{Simplify: "rdp", Tolerance: 1})
+	for i, p := range paths {
+		if len(p.Segments) != 1 {
+			t.Fatalf("Line %d simplified to %d segments, expected 1\n", i, len(p.Segments))
+		}
+	}
+	for i, want := range []float64{1, 4} {
+		if widths[i] != want {
+			t.Errorf("Line %d has width %v, expected %v\n", i, widths[i], want)
+		}
+	}
+	if widths[2] < 1 || widths[2] > 4 {
+		t.Errorf("Line 2 has width %v, outside 1 to 4\n", widths[2])
+	}
+}
+
+func TestSVGPathData(t *testing.T) {
+	p := Path{
+		Start: Vec2{0, 0},
+		Segments: []PathSegment{
+			{Curve: true, C1: Vec2{1, 0}, C2: Vec2{5, -1}, End: Vec2{6, 0}},
+			{End: Vec2{6, 6}},
+		},
+		Closed: true,
+	}
+
+	if d := svgPathData(p); d != "M0 0C1 0 5 -1 6 0L6 6Z" {
+		t.Fatalf("Path data is %s, expected M0 0C1 0 5 -1 6 0L6 6Z\n", d)
+	}
+}
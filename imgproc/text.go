@@ -0,0 +1,99 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"math"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	labelFontOnce sync.Once
+	labelFont     *opentype.Font
+	labelFaces    = map[int]font.Face{}
+	labelFacesMu  sync.Mutex
+)
+
+// regularFont returns the parsed Go Regular font.
+func regularFont() *opentype.Font {
+	labelFontOnce.Do(func() {
+		var err error
+		labelFont, err = opentype.Parse(goregular.TTF)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+	return labelFont
+}
+
+// labelFace returns the Go Regular font face at size pixels (em height),
+// caching faces so that labelling many regions doesn't re-create them.
+func labelFace(size int) font.Face {
+	regularFont()
+
+	labelFacesMu.Lock()
+	defer labelFacesMu.Unlock()
+
+	if face, ok := labelFaces[size]; ok {
+		return face
+	}
+	face, err := opentype.NewFace(labelFont, &opentype.FaceOptions{
+		Size:    float64(size),
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	labelFaces[size] = face
+	return face
+}
+
+// textExtent returns the width and height in pixels of the ink of text set at
+// size pixels.
+func textExtent(text string, size int) (float64, float64) {
+	bounds, _ := font.BoundString(labelFace(size), text)
+	width := float64(bounds.Max.X-bounds.Min.X) / 64
+	height := float64(bounds.Max.Y-bounds.Min.Y) / 64
+	return width, height
+}
+
+// DrawText draws text at size pixels in colour col, with the centre of its ink
+// at centre.
+func DrawText(dst draw.Image, text string, centre image.Point, size int, col color.Color) {
+	face := labelFace(size)
+	bounds, _ := font.BoundString(face, text)
+
+	// Offset the dot so the middle of the ink's bounding box lands on centre
+	midX := (bounds.Min.X + bounds.Max.X) / 2
+	midY := (bounds.Min.Y + bounds.Max.Y) / 2
+	drawer := font.Drawer{
+		Dst:  dst,
+		Src:  image.NewUniform(col),
+		Face: face,
+		Dot:  fixed.P(centre.X, centre.Y).Sub(fixed.Point26_6{X: midX, Y: midY}),
+	}
+	drawer.DrawString(text)
+}
+
+// FitTextSize returns the largest font size, between minSize and maxSize
+// pixels, at which text fits inside a circle of the given radius, or minSize
+// if it doesn't fit at any size in range.
+func FitTextSize(text string, radius float64, minSize, maxSize int) int {
+	best := minSize
+	for size := minSize; size <= maxSize; size++ {
+		w, h := textExtent(text, size)
+		if math.Hypot(w, h)/2 > radius {
+			break
+		}
+		best = size
+	}
+	return best
+}
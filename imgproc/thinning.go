@@ -0,0 +1,124 @@
+package cic
+
+// zhangSuenNeighbours returns the 8 neighbours of (x, y) in mask, in the order
+// P2 to P9 of Zhang and Suen: clockwise from the pixel above. Pixels outside
+// the grid are unset.
+func zhangSuenNeighbours(mask []bool, width, height, x, y int) [8]bool {
+	var p [8]bool
+	for i, off := range [8][2]int{{0, -1}, {1, -1}, {1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}} {
+		nx, ny := x+off[0], y+off[1]
+		p[i] = nx >= 0 && nx < width && ny >= 0 && ny < height && mask[ny*width+nx]
+	}
+	return p
+}
+
+// ZhangSuenThin thins the set pixels of a width × height mask, in raster order,
+// to a skeleton one pixel wide, preserving their connectivity and the ends of
+// lines. The mask is modified in place and returned.
+func ZhangSuenThin(mask []bool, width, height int) []bool {
+	var remove []int
+
+	for changed := true; changed; {
+		changed = false
+
+		for step := 0; step < 2; step++ {
+			remove = remove[:0]
+
+			for y := 0; y < height; y++ {
+				for x := 0; x < width; x++ {
+					if !mask[y*width+x] {
+						continue
+					}
+					p := zhangSuenNeighbours(mask, width, height, x, y)
+
+					// B: number of set neighbours. A: number of unset to set
+					// transitions going round the neighbours.
+					b, a := 0, 0
+					for i := range p {
+						if p[i] {
+							b++
+						}
+						if !p[i] && p[(i+1)%8] {
+							a++
+						}
+					}
+					if b < 2 || b > 6 || a != 1 {
+						continue
+					}
+
+					// P2, P4, P6 and P8 are p[0], p[2], p[4] and p[6]. The
+					// first step removes south-east boundary pixels and
+					// north-west corners, the second the opposite.
+					if step == 0 && (p[0] && p[2] && p[4] || p[2] && p[4] && p[6]) {
+						continue
+					}
+					if step == 1 && (p[0] && p[2] && p[6] || p[0] && p[4] && p[6]) {
+						continue
+					}
+					remove = append(remove, y*width+x)
+				}
+			}
+
+			for _, idx := range remove {
+				mask[idx] = false
+			}
+			changed = changed || len(remove) > 0
+		}
+	}
+
+	return mask
+}
+
+// FillHoles sets the unset pixels of a width × height mask which form
+// 4-connected holes of at most maxSize pixels, enclosed by set pixels. Thick
+// edges often have pinholes, which thinning would otherwise keep as tiny
+// loops. The mask is modified in place and returned.
+func FillHoles(mask []bool, width, height, maxSize int) []bool {
+	labels, sizes := LabelComponents(width, height, 4,
+		func(idx int) bool { return !mask[idx] },
+		func(a, b int) bool { return true },
+	)
+
+	// Background touching the edge of the image isn't enclosed
+	enclosed := make([]bool, len(sizes))
+	for label, size := range sizes {
+		enclosed[label] = size <= maxSize
+	}
+	for idx, label := range labels {
+		x, y := idx%width, idx/width
+		if label >= 0 && (x == 0 || y == 0 || x == width-1 || y == height-1) {
+			enclosed[label] = false
+		}
+	}
+
+	for idx, label := range labels {
+		if label >= 0 && enclosed[label] {
+			mask[idx] = true
+		}
+	}
+	return mask
+}
+
+// Thin reduces the edges of the gradients to lines one pixel wide, so that
+// doubled and tripled edges left by non-max suppression become single lines.
+// Pixels which remain keep their gradient values.
+func (ig *ImageGradients) Thin() *ImageGradients {
+	mask := make([]bool, ig.X*ig.Y)
+	for j := 0; j < ig.Y; j++ {
+		for i := 0; i < ig.X; i++ {
+			mask[j*ig.X+i] = ig.Value[j][i] > 0
+		}
+	}
+
+	ZhangSuenThin(mask, ig.X, ig.Y)
+
+	for j := 0; j < ig.Y; j++ {
+		for i := 0; i < ig.X; i++ {
+			if !mask[j*ig.X+i] {
+				ig.Value[j][i] = 0
+			}
+		}
+	}
+
+	return ig
+}
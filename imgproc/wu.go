@@ -0,0 +1,282 @@
+package cic
+
+import (
+	"image"
+	"image/color"
+)
+
+// wuSide is the number of cells along each side of the moment tables used by
+// Wu's quantiser: one per 5-bit channel value, plus a zero row so that
+// cumulative sums over a box can be computed by inclusion-exclusion.
+const wuSide = 33
+
+// Wu quantises an image with Xiaolin Wu's variance minimising colour
+// quantiser. Colours are binned into a 32×32×32 RGB grid, and the box of bins
+// with the greatest variance is repeatedly cut in two, along whichever channel
+// and at whichever position most reduces the total variance, until there are K
+// boxes. Each box's colour is the average of the pixels in it.
+type Wu struct {
+	K int
+}
+
+// wuBox is a box of bins, spanning channel values from r0 (exclusive) to r1
+// (inclusive), and likewise for green and blue.
+type wuBox struct {
+	r0, r1, g0, g1, b0, b1 int
+	vol                    int
+}
+
+// wuMoments holds cumulative moments of the colour distribution: at each
+// [r][g][b], the sum over all bins with smaller or equal indices.
+type wuMoments struct {
+	wt, mr, mg, mb, m2 []float64
+}
+
+func wuIdx(r, g, b int) int {
+	return (r*wuSide+g)*wuSide + b
+}
+
+func newWuMoments(h *ColourHistogram) *wuMoments {
+	size := wuSide * wuSide * wuSide
+	m := wuMoments{
+		wt: make([]float64, size),
+		mr: make([]float64, size),
+		mg: make([]float64, size),
+		mb: make([]float64, size),
+		m2: make([]float64, size),
+	}
+
+	for _, cc := range h.Colours {
+		c := cc.Colour
+		idx := wuIdx(int(c.R>>3)+1, int(c.G>>3)+1, int(c.B>>3)+1)
+		r, g, b := float64(c.R), float64(c.G), float64(c.B)
+		m.wt[idx] += cc.Count
+		m.mr[idx] += r * cc.Count
+		m.mg[idx] += g * cc.Count
+		m.mb[idx] += b * cc.Count
+		m.m2[idx] += (r*r + g*g + b*b) * cc.Count
+	}
+
+	// Convert bin totals to cumulative moments
+	for _, table := range [][]float64{m.wt, m.mr, m.mg, m.mb, m.m2} {
+		for r := 1; r < wuSide; r++ {
+			var area [wuSide]float64
+			for g := 1; g < wuSide; g++ {
+				line := 0.0
+				for b := 1; b < wuSide; b++ {
+					line += table[wuIdx(r, g, b)]
+					area[b] += line
+					table[wuIdx(r, g, b)] = table[wuIdx(r-1, g, b)] + area[b]
+				}
+			}
+		}
+	}
+
+	return &m
+}
+
+// volume returns the sum of a moment over a box.
+func (bx wuBox) volume(m []float64) float64 {
+	return m[wuIdx(bx.r1, bx.g1, bx.b1)] -
+		m[wuIdx(bx.r1, bx.g1, bx.b0)] -
+		m[wuIdx(bx.r1, bx.g0, bx.b1)] +
+		m[wuIdx(bx.r1, bx.g0, bx.b0)] -
+		m[wuIdx(bx.r0, bx.g1, bx.b1)] +
+		m[wuIdx(bx.r0, bx.g1, bx.b0)] +
+		m[wuIdx(bx.r0, bx.g0, bx.b1)] -
+		m[wuIdx(bx.r0, bx.g0, bx.b0)]
+}
+
+// bottom returns the part of a box's moment sum which does not depend on the
+// position of a cut along channel ch.
+func (bx wuBox) bottom(ch int, m []float64) float64 {
+	switch ch {
+	case 0:
+		return -m[wuIdx(bx.r0, bx.g1, bx.b1)] +
+			m[wuIdx(bx.r0, bx.g1, bx.b0)] +
+			m[wuIdx(bx.r0, bx.g0, bx.b1)] -
+			m[wuIdx(bx.r0, bx.g0, bx.b0)]
+	case 1:
+		return -m[wuIdx(bx.r1, bx.g0, bx.b1)] +
+			m[wuIdx(bx.r1, bx.g0, bx.b0)] +
+			m[wuIdx(bx.r0, bx.g0, bx.b1)] -
+			m[wuIdx(bx.r0, bx.g0, bx.b0)]
+	default:
+		return -m[wuIdx(bx.r1, bx.g1, bx.b0)] +
+			m[wuIdx(bx.r1, bx.g0, bx.b0)] +
+			m[wuIdx(bx.r0, bx.g1, bx.b0)] -
+			m[wuIdx(bx.r0, bx.g0, bx.b0)]
+	}
+}
+
+// top returns the part of a box's moment sum which depends on a cut at pos
+// along channel ch.
+func (bx wuBox) top(ch, pos int, m []float64) float64 {
+	switch ch {
+	case 0:
+		return m[wuIdx(pos, bx.g1, bx.b1)] -
+			m[wuIdx(pos, bx.g1, bx.b0)] -
+			m[wuIdx(pos, bx.g0, bx.b1)] +
+			m[wuIdx(pos, bx.g0, bx.b0)]
+	case 1:
+		return m[wuIdx(bx.r1, pos, bx.b1)] -
+			m[wuIdx(bx.r1, pos, bx.b0)] -
+			m[wuIdx(bx.r0, pos, bx.b1)] +
+			m[wuIdx(bx.r0, pos, bx.b0)]
+	default:
+		return m[wuIdx(bx.r1, bx.g1, pos)] -
+			m[wuIdx(bx.r1, bx.g0, pos)] -
+			m[wuIdx(bx.r0, bx.g1, pos)] +
+			m[wuIdx(bx.r0, bx.g0, pos)]
+	}
+}
+
+// variance returns the weighted variance of the colours in a box.
+func (m *wuMoments) variance(bx wuBox) float64 {
+	dr, dg, db := bx.volume(m.mr), bx.volume(m.mg), bx.volume(m.mb)
+	wt := bx.volume(m.wt)
+	if wt == 0 {
+		return 0
+	}
+	return bx.volume(m.m2) - (dr*dr+dg*dg+db*db)/wt
+}
+
+// maximise finds the cut along channel ch, between first and last, which
+// maximises the sum of squared mean distances of the two halves (and so
+// minimises their combined variance). It returns the score and the cut
+// position, or -1 if no cut leaves pixels on both sides.
+func (m *wuMoments) maximise(bx wuBox, ch, first, last int, whole [4]float64) (float64, int) {
+	base := [4]float64{
+		bx.bottom(ch, m.mr),
+		bx.bottom(ch, m.mg),
+		bx.bottom(ch, m.mb),
+		bx.bottom(ch, m.wt),
+	}
+
+	best, cut := 0.0, -1
+	for pos := first; pos < last; pos++ {
+		half := [4]float64{
+			base[0] + bx.top(ch, pos, m.mr),
+			base[1] + bx.top(ch, pos, m.mg),
+			base[2] + bx.top(ch, pos, m.mb),
+			base[3] + bx.top(ch, pos, m.wt),
+		}
+		if half[3] == 0 {
+			continue
+		}
+		score := (half[0]*half[0] + half[1]*half[1] + half[2]*half[2]) / half[3]
+
+		for i := range half {
+			half[i] = whole[i] - half[i]
+		}
+		if half[3] == 0 {
+			continue
+		}
+		score += (half[0]*half[0] + half[1]*half[1] + half[2]*half[2]) / half[3]
+
+		if score > best {
+			best, cut = score, pos
+		}
+	}
+
+	return best, cut
+}
+
+// cut splits box a in two, returning the shrunk box a and the new box b, or
+// false if a cannot be split.
+func (m *wuMoments) cut(a wuBox) (wuBox, wuBox, bool) {
+	whole := [4]float64{a.volume(m.mr), a.volume(m.mg), a.volume(m.mb), a.volume(m.wt)}
+
+	maxR, cutR := m.maximise(a, 0, a.r0+1, a.r1, whole)
+	maxG, cutG := m.maximise(a, 1, a.g0+1, a.g1, whole)
+	maxB, cutB := m.maximise(a, 2, a.b0+1, a.b1, whole)
+
+	b := a
+	switch {
+	case maxR >= maxG && maxR >= maxB:
+		if cutR < 0 {
+			return a, b, false
+		}
+		a.r1, b.r0 = cutR, cutR
+	case maxG >= maxR && maxG >= maxB:
+		a.g1, b.g0 = cutG, cutG
+	default:
+		a.b1, b.b0 = cutB, cutB
+	}
+
+	a.vol = (a.r1 - a.r0) * (a.g1 - a.g0) * (a.b1 - a.b0)
+	b.vol = (b.r1 - b.r0) * (b.g1 - b.g0) * (b.b1 - b.b0)
+	return a, b, true
+}
+
+func (w Wu) Quantise(img *image.RGBA) *image.Paletted {
+	h := NewColourHistogram(img, RGBSpace)
+	k := paletteSize(w.K)
+	m := newWuMoments(h)
+
+	boxes := []wuBox{{0, wuSide - 1, 0, wuSide - 1, 0, wuSide - 1, 0}}
+	variances := []float64{0}
+	next := 0
+
+	for len(boxes) < k {
+		a, b, ok := m.cut(boxes[next])
+		if ok {
+			boxes[next] = a
+			boxes = append(boxes, b)
+			variances = append(variances, 0)
+			for _, i := range []int{next, len(boxes) - 1} {
+				if boxes[i].vol > 1 {
+					variances[i] = m.variance(boxes[i])
+				} else {
+					variances[i] = 0
+				}
+			}
+		} else {
+			// This box cannot be cut, so don't try again
+			variances[next] = 0
+		}
+
+		next = 0
+		for i, v := range variances {
+			if v > variances[next] {
+				next = i
+			}
+		}
+		if variances[next] <= 0 {
+			break
+		}
+	}
+
+	// Tag each bin with the box it falls in
+	tags := make([]int, wuSide*wuSide*wuSide)
+	palette := make(color.Palette, len(boxes))
+	for i, bx := range boxes {
+		wt := bx.volume(m.wt)
+		if wt > 0 {
+			palette[i] = color.RGBA{
+				clampUint8(bx.volume(m.mr) / wt),
+				clampUint8(bx.volume(m.mg) / wt),
+				clampUint8(bx.volume(m.mb) / wt),
+				255,
+			}
+		} else {
+			palette[i] = color.RGBA{0, 0, 0, 255}
+		}
+
+		for r := bx.r0 + 1; r <= bx.r1; r++ {
+			for g := bx.g0 + 1; g <= bx.g1; g++ {
+				for b := bx.b0 + 1; b <= bx.b1; b++ {
+					tags[wuIdx(r, g, b)] = i
+				}
+			}
+		}
+	}
+
+	assignments := make([]int, len(h.Colours))
+	for idx, cc := range h.Colours {
+		c := cc.Colour
+		assignments[idx] = tags[wuIdx(int(c.R>>3)+1, int(c.G>>3)+1, int(c.B>>3)+1)]
+	}
+
+	return palettedFromHistogram(img, h, palette, assignments)
+}